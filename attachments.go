@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/dvcrn/pocketsmith-anapay/internal/syncstate"
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+	"github.com/dvcrn/pocketsmith-go"
+	"github.com/getsentry/sentry-go"
+)
+
+// attachmentMarker tags uploaded attachments with their Moneytree ID, so they
+// can be recognized again without a state file.
+func attachmentMarker(attachmentID int) string {
+	return fmt.Sprintf("mtattachment=%d", attachmentID)
+}
+
+// transferAttachments uploads the Moneytree attachments of tx that haven't
+// been transferred yet to Pocketsmith and attaches them to psTxID.
+// Transferred attachments are tracked in state when there is one, otherwise
+// the transaction's current Pocketsmith attachments are checked instead.
+func transferAttachments(ctx context.Context, ps *pocketsmith.Client, mt *moneytree.Moneytree, userID int, state *syncstate.State, tx *moneytree.MTTransaction, psTxID int64) error {
+	if len(tx.TransactionAttachments) == 0 {
+		return nil
+	}
+
+	var existing []*pocketsmith.Attachment
+	if state == nil {
+		var err error
+		existing, err = ps.ListTransactionAttachments(psTxID)
+		if err != nil {
+			return fmt.Errorf("listing Pocketsmith attachments: %w", err)
+		}
+	}
+
+	for _, attachment := range tx.TransactionAttachments {
+		marker := attachmentMarker(attachment.ID)
+		if state != nil {
+			if _, ok := state.Attachments[attachment.ID]; ok {
+				continue
+			}
+		} else if hasAttachment(existing, marker) {
+			continue
+		}
+
+		data, err := mt.DownloadAttachmentContext(ctx, attachment)
+		if err != nil {
+			return fmt.Errorf("downloading attachment %d: %w", attachment.ID, err)
+		}
+
+		fileName := attachment.FileName
+		if fileName == "" {
+			fileName = fmt.Sprintf("moneytree-%d", attachment.ID)
+		}
+
+		created, err := ps.CreateAttachment(userID, &pocketsmith.CreateAttachment{
+			Title:    fmt.Sprintf("%s %s", fileName, marker),
+			FileName: fileName,
+			FileData: base64.StdEncoding.EncodeToString(data),
+		})
+		if err != nil {
+			return fmt.Errorf("uploading attachment %d: %w", attachment.ID, err)
+		}
+
+		if err := ps.AssignToTransaction(psTxID, created.ID); err != nil {
+			return fmt.Errorf("attaching attachment %d to transaction %d: %w", attachment.ID, psTxID, err)
+		}
+
+		fmt.Printf("Transferred attachment %s to Pocketsmith transaction %d\n", fileName, psTxID)
+
+		if state != nil {
+			state.Attachments[attachment.ID] = created.ID
+			if err := state.Save(); err != nil {
+				sentry.CaptureException(err)
+				fmt.Println("Error saving sync state: ", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+func hasAttachment(attachments []*pocketsmith.Attachment, marker string) bool {
+	for _, attachment := range attachments {
+		if strings.Contains(attachment.Title, marker) {
+			return true
+		}
+	}
+
+	return false
+}
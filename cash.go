@@ -0,0 +1,24 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+)
+
+// cashInstitutionName is the Pocketsmith institution cash wallets are created
+// under, since Pocketsmith needs one for every account. It is not part of the
+// account name.
+const cashInstitutionName = "Cash"
+
+// cashWalletName is the account name of a Moneytree cash wallet. Wallets have
+// no account number, so only their name is used.
+func cashWalletName(account moneytree.MTAccount) string {
+	for _, name := range []string{account.Nickname, account.InstitutionAccountName} {
+		if name = strings.TrimSpace(name); name != "" {
+			return name
+		}
+	}
+
+	return "Cash Wallet"
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dvcrn/pocketsmith-anapay/internal/categorymap"
+	"github.com/dvcrn/pocketsmith-anapay/internal/pocketsmithx"
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+)
+
+// newCategoryMapper loads Moneytree and Pocketsmith categories and the
+// mapping file. If the mapping file doesn't exist yet, a template listing all
+// Moneytree categories is written there for the user to fill in.
+func newCategoryMapper(ctx context.Context, mt *moneytree.Moneytree, psx *pocketsmithx.Client, userID int, config *Config) (*categorymap.Mapper, error) {
+	mtCategories, err := mt.GetCategoriesContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("getting Moneytree categories: %w", err)
+	}
+
+	psCategories, err := psx.ListCategories(userID)
+	if err != nil {
+		return nil, fmt.Errorf("getting Pocketsmith categories: %w", err)
+	}
+
+	var file *categorymap.File
+	if config.CategoryMapPath != "" {
+		file, err = categorymap.LoadFile(config.CategoryMapPath)
+		if errors.Is(err, os.ErrNotExist) {
+			if err := categorymap.WriteTemplate(config.CategoryMapPath, mtCategories); err != nil {
+				return nil, fmt.Errorf("writing category map template: %w", err)
+			}
+			fmt.Println("Wrote a category map template to", config.CategoryMapPath, "- fill in the Pocketsmith category for each Moneytree category")
+			file = nil
+		} else if err != nil {
+			return nil, err
+		}
+	}
+
+	return categorymap.NewMapper(userID, mtCategories, psCategories, file, psx, config.CreateCategories), nil
+}
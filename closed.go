@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/dvcrn/pocketsmith-anapay/internal/syncstate"
+	"github.com/dvcrn/pocketsmith-go"
+	"github.com/getsentry/sentry-go"
+)
+
+// closedMarker is appended to the title of Pocketsmith accounts whose
+// Moneytree account was closed.
+const closedMarker = " (closed)"
+
+// What to do with the Pocketsmith account of a closed Moneytree account.
+const (
+	closedActionBalance = "balance"
+	closedActionExclude = "exclude"
+	closedActionRename  = "rename"
+)
+
+// parseClosedActions parses a comma-separated list of closed-account actions.
+// "all" enables every action.
+func parseClosedActions(value string) (map[string]bool, error) {
+	actions := map[string]bool{}
+	for _, action := range splitList(value) {
+		switch action {
+		case "all":
+			actions[closedActionBalance] = true
+			actions[closedActionExclude] = true
+			actions[closedActionRename] = true
+		case closedActionBalance, closedActionExclude, closedActionRename:
+			actions[action] = true
+		default:
+			return nil, fmt.Errorf("unknown action %q, use balance, exclude, rename or all", action)
+		}
+	}
+
+	return actions, nil
+}
+
+// closeAccount applies the configured actions to the Pocketsmith account of a
+// closed Moneytree account. Accounts that were never synced are left alone,
+// and nothing is ever deleted.
+func closeAccount(ps *pocketsmith.Client, userID int, state *syncstate.State, name accountName, finalBalance float64, actions map[string]bool) {
+	accounts, err := ps.ListAccounts(userID)
+	if err != nil {
+		sentry.CaptureException(err)
+		fmt.Println("Error listing accounts: ", err)
+		return
+	}
+
+	account, _, err := lookupAccount(accounts, state, name)
+	if err == pocketsmith.ErrNotFound {
+		return
+	}
+	if err != nil {
+		sentry.CaptureException(err)
+		fmt.Println("Error finding closed account: ", err)
+		return
+	}
+
+	if actions[closedActionBalance] && math.Abs(account.CurrentBalance-finalBalance) >= 0.005 {
+		fmt.Printf("Setting final balance of closed account %q: %.2f\n", account.Title, finalBalance)
+		_, err := ps.UpdateTransactionAccount(account.PrimaryTransactionAccount.ID, account.PrimaryTransactionAccount.Institution.ID, finalBalance, time.Now().Format("2006-01-02"))
+		if err != nil {
+			sentry.CaptureException(err)
+			fmt.Println("Error setting final balance: ", err)
+		}
+	}
+
+	title, isNetWorth := closedSettings(account, actions)
+	if title == account.Title && isNetWorth == account.IsNetWorth {
+		return
+	}
+
+	fmt.Printf("Marking Pocketsmith account %q as closed: title %q, net worth %t\n", account.Title, title, isNetWorth)
+	if _, err := ps.UpdateAccount(account.ID, title, account.CurrencyCode, account.Type, isNetWorth); err != nil {
+		sentry.CaptureException(err)
+		fmt.Println("Error marking account as closed: ", err)
+		return
+	}
+
+	if state != nil && name.moneytreeID != 0 {
+		state.MarkClosed(name.moneytreeID, syncstate.ClosedAccount{PocketsmithID: account.ID, IsNetWorth: account.IsNetWorth})
+		if err := state.Save(); err != nil {
+			sentry.CaptureException(err)
+			fmt.Println("Error saving sync state: ", err)
+		}
+	}
+}
+
+// closedSettings returns the title and net worth setting the actions give the
+// Pocketsmith account of a closed Moneytree account. Accounts that are
+// already marked as closed keep their settings.
+func closedSettings(account *pocketsmith.Account, actions map[string]bool) (title string, isNetWorth bool) {
+	title = account.Title
+	if actions[closedActionRename] && !strings.HasSuffix(title, closedMarker) {
+		title += closedMarker
+	}
+
+	return title, account.IsNetWorth && !actions[closedActionExclude]
+}
+
+// reopenedNetWorth returns whether the Pocketsmith account of a Moneytree
+// account that is in use again counts towards net worth, undoing
+// closeAccount. ok is false when the sync never closed the account. Without a
+// state file, nothing was recorded and only a title marked as closed tells
+// that it was.
+func reopenedNetWorth(state *syncstate.State, name accountName, account *pocketsmith.Account) (isNetWorth bool, ok bool) {
+	if state == nil {
+		return true, strings.HasSuffix(account.Title, closedMarker)
+	}
+
+	closed, ok := state.ClosedAccount(name.moneytreeID)
+	if !ok || name.moneytreeID == 0 || closed.PocketsmithID != account.ID {
+		return false, false
+	}
+
+	return closed.IsNetWorth, true
+}
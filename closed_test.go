@@ -0,0 +1,82 @@
+package main
+
+import (
+	"maps"
+	"path/filepath"
+	"testing"
+
+	"github.com/dvcrn/pocketsmith-anapay/internal/syncstate"
+	"github.com/dvcrn/pocketsmith-go"
+)
+
+func TestParseClosedActions(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    map[string]bool
+		wantErr bool
+	}{
+		{"Empty", "", map[string]bool{}, false},
+		{"Single action", "exclude", map[string]bool{closedActionExclude: true}, false},
+		{"Several actions with spaces", " balance , rename ", map[string]bool{closedActionBalance: true, closedActionRename: true}, false},
+		{"All", "all", map[string]bool{closedActionBalance: true, closedActionExclude: true, closedActionRename: true}, false},
+		{"Unknown action", "exclude,delete", nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseClosedActions(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseClosedActions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("parseClosedActions() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClosedSettingsIsIdempotent(t *testing.T) {
+	actions := map[string]bool{closedActionExclude: true, closedActionRename: true}
+	account := &pocketsmith.Account{ID: 1, Title: "Rakuten Bank: Savings (1234567)", IsNetWorth: true}
+
+	title, isNetWorth := closedSettings(account, actions)
+	if want := "Rakuten Bank: Savings (1234567)" + closedMarker; title != want || isNetWorth {
+		t.Fatalf("closedSettings() = %q, %t, want %q, false", title, isNetWorth, want)
+	}
+
+	closed := &pocketsmith.Account{ID: 1, Title: title, IsNetWorth: isNetWorth}
+	if again, isNetWorth := closedSettings(closed, actions); again != title || isNetWorth {
+		t.Errorf("closedSettings() of a closed account = %q, %t, want it unchanged", again, isNetWorth)
+	}
+}
+
+func TestReopenedNetWorth(t *testing.T) {
+	state, err := syncstate.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	name := accountName{moneytreeID: 42, display: "Rakuten Bank: Savings (1234567)"}
+
+	// closed with only the exclude action, so the title gives nothing away
+	account := &pocketsmith.Account{ID: 1, Title: name.display, IsNetWorth: false}
+	if _, ok := reopenedNetWorth(state, name, account); ok {
+		t.Error("reopenedNetWorth() of an account the sync never closed = ok, want not ok")
+	}
+
+	state.MarkClosed(42, syncstate.ClosedAccount{PocketsmithID: 1, IsNetWorth: true})
+	if isNetWorth, ok := reopenedNetWorth(state, name, account); !ok || !isNetWorth {
+		t.Errorf("reopenedNetWorth() = %t, %t, want the recorded true, true", isNetWorth, ok)
+	}
+
+	state.Reopen(42)
+	state.MarkClosed(42, syncstate.ClosedAccount{PocketsmithID: 1, IsNetWorth: false})
+	if isNetWorth, ok := reopenedNetWorth(state, name, account); !ok || isNetWorth {
+		t.Errorf("reopenedNetWorth() of an account excluded before closing = %t, %t, want false, true", isNetWorth, ok)
+	}
+
+	relinked := &pocketsmith.Account{ID: 2, Title: name.display}
+	if _, ok := reopenedNetWorth(state, name, relinked); ok {
+		t.Error("reopenedNetWorth() of another Pocketsmith account = ok, want not ok")
+	}
+}
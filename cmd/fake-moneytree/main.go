@@ -0,0 +1,38 @@
+// Command fake-moneytree serves a fake Moneytree API from a scenario file, for
+// trying out the sync without a real Moneytree account.
+//
+//	go run ./cmd/fake-moneytree -scenario moneytree/moneytreetest/testdata/scenario.json
+//	MONEYTREE_AUTH_URL=http://localhost:8080 ./pocketsmith-moneytree -username demo@example.com -password demo -apikey fake ...
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/dvcrn/pocketsmith-anapay/moneytree/moneytreetest"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "Address to listen on")
+	scenarioPath := flag.String("scenario", "", "JSON scenario file to serve")
+	flag.Parse()
+
+	if *scenarioPath == "" {
+		fmt.Fprintln(os.Stderr, "-scenario is required")
+		os.Exit(2)
+	}
+
+	scenario, err := moneytreetest.LoadScenario(*scenarioPath)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("Serving fake Moneytree API from %s on http://%s\n", *scenarioPath, *addr)
+	if err := http.ListenAndServe(*addr, moneytreetest.New(scenario)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
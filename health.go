@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+	"github.com/getsentry/sentry-go"
+)
+
+// exitCodeCredentialProblems is the exit code when -fail-on-credential-problems
+// is set and a credential needs attention.
+const exitCodeCredentialProblems = 3
+
+type credentialProblem struct {
+	Credential moneytree.MTCredential
+	Problems   []string
+}
+
+// checkCredentialHealth lists credentials that are in error, need the guest to
+// re-authenticate, or haven't refreshed successfully within staleAfter.
+func checkCredentialHealth(credentials []moneytree.MTCredential, staleAfter time.Duration, now time.Time) []credentialProblem {
+	var result []credentialProblem
+	for _, credential := range credentials {
+		var problems []string
+
+		switch {
+		case credential.NeedsReauth():
+			problems = append(problems, fmt.Sprintf("needs re-authentication in the Moneytree app (status %q)", credential.Status))
+		case credential.InError():
+			problem := fmt.Sprintf("refresh failed (status %q)", credential.Status)
+			if !credential.ErrorInfo.IsEmpty() {
+				problem += ": " + credential.ErrorInfo.String()
+			}
+			problems = append(problems, problem)
+		}
+
+		if credential.AdditionalStatusInformation != nil && credential.AdditionalStatusInformation.Message != "" && len(problems) > 0 {
+			problems = append(problems, credential.AdditionalStatusInformation.Message)
+		}
+
+		if staleAfter > 0 && credential.IsStale(now, staleAfter) {
+			if credential.LastSuccess == "" {
+				problems = append(problems, "never refreshed successfully")
+			} else {
+				problems = append(problems, fmt.Sprintf("no successful refresh since %s", credential.LastSuccess))
+			}
+		}
+
+		if len(problems) > 0 {
+			result = append(result, credentialProblem{Credential: credential, Problems: problems})
+		}
+	}
+
+	return result
+}
+
+// credentialExitCode is the exit code of a run that found problems, 0 when
+// the run should succeed regardless.
+func credentialExitCode(problems []credentialProblem, config *Config) int {
+	if len(problems) > 0 && config.FailOnCredentialProblems {
+		return exitCodeCredentialProblems
+	}
+
+	return 0
+}
+
+// reportCredentialHealth prints the credential part of the run summary and
+// returns the problems found. The guest is fetched again so the summary
+// reflects the state after this run's refresh; if that fails, fallback is
+// used.
+func reportCredentialHealth(ctx context.Context, mt *moneytree.Moneytree, fallback *moneytree.MTGuest, config *Config) []credentialProblem {
+	guest, err := mt.GetGuestMetaContext(ctx)
+	if err != nil {
+		sentry.CaptureException(err)
+		fmt.Println("Error getting credential status for the summary, using the status from the start of the run: ", err)
+		guest = fallback
+	}
+
+	problems := checkCredentialHealth(guest.Credentials, config.StaleAfter, time.Now())
+	if len(problems) == 0 {
+		fmt.Println("All Moneytree credentials are healthy")
+		return nil
+	}
+
+	fmt.Printf("%d Moneytree credential(s) need attention:\n", len(problems))
+	for _, p := range problems {
+		line := fmt.Sprintf("%s (credential %d): %s", p.Credential.InstitutionName, p.Credential.ID, strings.Join(p.Problems, "; "))
+		fmt.Println("  " + line)
+		sentry.CaptureMessage("Moneytree credential needs attention: " + line)
+	}
+
+	return problems
+}
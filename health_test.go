@@ -0,0 +1,76 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+)
+
+func TestCheckCredentialHealth(t *testing.T) {
+	now := time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)
+	recent := "2025-01-09T00:00:00Z"
+
+	tests := []struct {
+		name       string
+		credential moneytree.MTCredential
+		want       []string
+	}{
+		{
+			name:       "healthy",
+			credential: moneytree.MTCredential{Status: moneytree.CredentialStatusSuccess, LastSuccess: recent},
+		},
+		{
+			name:       "needs re-authentication",
+			credential: moneytree.MTCredential{Status: "auth_failed", LastSuccess: recent},
+			want:       []string{`needs re-authentication in the Moneytree app (status "auth_failed")`},
+		},
+		{
+			name: "in error",
+			credential: moneytree.MTCredential{
+				Status:                      "fetch_failed",
+				LastSuccess:                 recent,
+				AdditionalStatusInformation: &moneytree.MTAdditionalStatusInformation{Message: "Bank under maintenance"},
+			},
+			want: []string{`refresh failed (status "fetch_failed")`, "Bank under maintenance"},
+		},
+		{
+			name:       "stale",
+			credential: moneytree.MTCredential{Status: moneytree.CredentialStatusSuccess, LastSuccess: "2024-12-01T00:00:00Z"},
+			want:       []string{"no successful refresh since 2024-12-01T00:00:00Z"},
+		},
+		{
+			name:       "never refreshed",
+			credential: moneytree.MTCredential{Status: moneytree.CredentialStatusSuccess},
+			want:       []string{"never refreshed successfully"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			problems := checkCredentialHealth([]moneytree.MTCredential{tt.credential}, 7*24*time.Hour, now)
+
+			var got []string
+			if len(problems) == 1 {
+				got = problems[0].Problems
+			} else if len(problems) > 1 {
+				t.Fatalf("checkCredentialHealth() = %d entries for one credential", len(problems))
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("problems = %q, want %q", got, tt.want)
+			}
+
+			wantCode := 0
+			if len(tt.want) > 0 {
+				wantCode = exitCodeCredentialProblems
+			}
+			if code := credentialExitCode(problems, &Config{FailOnCredentialProblems: true}); code != wantCode {
+				t.Errorf("credentialExitCode() = %d, want %d", code, wantCode)
+			}
+			if code := credentialExitCode(problems, &Config{}); code != 0 {
+				t.Errorf("credentialExitCode() without -fail-on-credential-problems = %d, want 0", code)
+			}
+		})
+	}
+}
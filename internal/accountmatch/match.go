@@ -3,6 +3,7 @@ package accountmatch
 import (
 	"fmt"
 	"strings"
+	"unicode"
 
 	"github.com/dvcrn/pocketsmith-go"
 )
@@ -11,14 +12,26 @@ func normalizeAccountTitle(title string) string {
 	return strings.ToLower(strings.Join(strings.Fields(title), " "))
 }
 
+// BuildDisplayAccountName is the Pocketsmith title of an account:
+// "Institution - Name", or just the name for accounts without an institution
+// such as cash wallets.
 func BuildDisplayAccountName(institutionName, baseName string) string {
 	if strings.TrimSpace(institutionName) == "" {
 		return baseName
 	}
+	if strings.TrimSpace(baseName) == "" {
+		return institutionName
+	}
 
 	return fmt.Sprintf("%s - %s", institutionName, baseName)
 }
 
+// SameTitle reports whether two account titles are equal, ignoring case and
+// whitespace like the matching does.
+func SameTitle(a, b string) bool {
+	return normalizeAccountTitle(a) == normalizeAccountTitle(b)
+}
+
 func FindMatchingAccount(accounts []*pocketsmith.Account, institutionName, baseName, displayName string) (*pocketsmith.Account, error) {
 	normalizedBase := normalizeAccountTitle(baseName)
 	normalizedDisplay := normalizeAccountTitle(displayName)
@@ -40,14 +53,18 @@ func FindMatchingAccount(accounts []*pocketsmith.Account, institutionName, baseN
 			continue
 		}
 
+		// without an institution, a title ending in the name most likely
+		// belongs to another institution's account of the same name
+		if normalizedInstitution == "" {
+			continue
+		}
+
 		if strings.HasSuffix(normalizedTitle, normalizedBase) {
 			suffixMatches = append(suffixMatches, account)
 
-			if normalizedInstitution != "" {
-				accountInstitution := normalizeAccountTitle(account.PrimaryTransactionAccount.Institution.Title)
-				if accountInstitution == normalizedInstitution {
-					institutionMatches = append(institutionMatches, account)
-				}
+			accountInstitution := normalizeAccountTitle(account.PrimaryTransactionAccount.Institution.Title)
+			if accountInstitution == normalizedInstitution {
+				institutionMatches = append(institutionMatches, account)
 			}
 		}
 	}
@@ -79,3 +96,127 @@ func FindMatchingAccount(accounts []*pocketsmith.Account, institutionName, baseN
 
 	return nil, pocketsmith.ErrNotFound
 }
+
+// Candidate is a title an account may have in Pocketsmith, as passed to
+// FindMatchingAccount.
+type Candidate struct {
+	BaseName    string
+	DisplayName string
+}
+
+// FindMatchingAccountByCandidates tries the candidates in order and returns
+// the first match, so accounts still titled under an older naming scheme are
+// found instead of being created a second time.
+func FindMatchingAccountByCandidates(accounts []*pocketsmith.Account, institutionName string, candidates []Candidate) (*pocketsmith.Account, error) {
+	for _, candidate := range candidates {
+		account, err := FindMatchingAccount(accounts, institutionName, candidate.BaseName, candidate.DisplayName)
+		if err != pocketsmith.ErrNotFound {
+			return account, err
+		}
+	}
+
+	return nil, pocketsmith.ErrNotFound
+}
+
+// FindMatchingAccountByNumber finds the account of an institution whose title
+// contains the account number, in full or masked down to its last four
+// digits, so titles from an earlier naming template are still recognized.
+// With a suffix, like the ticker of a holding, only titles ending in it
+// match. Without one, titles continuing after the number with " - " are left
+// out, they belong to the holdings of the account. An empty currency matches
+// any.
+func FindMatchingAccountByNumber(accounts []*pocketsmith.Account, institutionName, currency, number, suffix string) (*pocketsmith.Account, error) {
+	normalizedInstitution := normalizeAccountTitle(institutionName)
+	normalizedSuffix := normalizeAccountTitle(suffix)
+	if normalizedInstitution == "" || len([]rune(strings.TrimSpace(number))) < 4 {
+		return nil, pocketsmith.ErrNotFound
+	}
+
+	var matches []*pocketsmith.Account
+	for _, account := range accounts {
+		if normalizeAccountTitle(account.PrimaryTransactionAccount.Institution.Title) != normalizedInstitution {
+			continue
+		}
+		if currency != "" && !strings.EqualFold(account.CurrencyCode, currency) {
+			continue
+		}
+
+		title := normalizeAccountTitle(account.Title)
+		if normalizedSuffix != "" {
+			var ok bool
+			if title, ok = strings.CutSuffix(title, normalizedSuffix); !ok {
+				continue
+			}
+		}
+
+		if containsAccountNumber(title, number) {
+			matches = append(matches, account)
+		}
+	}
+
+	if len(matches) == 1 {
+		return matches[0], nil
+	}
+	if len(matches) > 1 {
+		return nil, fmt.Errorf("multiple Pocketsmith accounts of %q match account number %q; rename to disambiguate", institutionName, number)
+	}
+
+	return nil, pocketsmith.ErrNotFound
+}
+
+// containsAccountNumber reports whether title contains number, with any of
+// its digits but the last four possibly masked with "*". A number followed by
+// " - " doesn't count, see FindMatchingAccountByNumber.
+func containsAccountNumber(title, number string) bool {
+	var want []rune
+	for _, r := range number {
+		if unicode.IsDigit(r) {
+			want = append(want, r)
+		}
+	}
+	if len(want) < 4 {
+		return false
+	}
+
+	runes := []rune(title)
+	for start := 0; start < len(runes); start++ {
+		if !isNumberRune(runes[start]) || (start > 0 && isNumberRune(runes[start-1])) {
+			continue
+		}
+
+		end := start
+		for end < len(runes) && isNumberRune(runes[end]) {
+			end++
+		}
+
+		if matchesNumber(runes[start:end], want) && !strings.Contains(string(runes[end:]), " - ") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesNumber reports whether got is want, aligned on the last digit, where
+// "*" stands for any digit but the last four.
+func matchesNumber(got, want []rune) bool {
+	if len(got) < 4 {
+		return false
+	}
+
+	for i := 1; i <= len(got); i++ {
+		r := got[len(got)-i]
+		if r == '*' && i > 4 {
+			continue
+		}
+		if i > len(want) || r != want[len(want)-i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func isNumberRune(r rune) bool {
+	return r == '*' || unicode.IsDigit(r)
+}
@@ -0,0 +1,92 @@
+package accountmatch
+
+import (
+	"testing"
+
+	"github.com/dvcrn/pocketsmith-go"
+)
+
+func TestBuildDisplayAccountName(t *testing.T) {
+	tests := []struct {
+		institution, base, want string
+	}{
+		{"Rakuten Bank", "Savings (1234567)", "Rakuten Bank - Savings (1234567)"},
+		{"", "Wallet", "Wallet"},
+		{"  ", "Wallet", "Wallet"},
+		{"Rakuten Bank", "", "Rakuten Bank"},
+	}
+
+	for _, tt := range tests {
+		if got := BuildDisplayAccountName(tt.institution, tt.base); got != tt.want {
+			t.Errorf("BuildDisplayAccountName(%q, %q) = %q, want %q", tt.institution, tt.base, got, tt.want)
+		}
+	}
+}
+
+func TestFindMatchingAccountWithoutInstitution(t *testing.T) {
+	accounts := []*pocketsmith.Account{
+		{ID: 1, Title: "Rakuten Bank - Wallet"},
+		{ID: 2, Title: "Wallet"},
+	}
+
+	got, err := FindMatchingAccount(accounts, "", "Wallet", BuildDisplayAccountName("", "Wallet"))
+	if err != nil {
+		t.Fatalf("FindMatchingAccount() error = %v", err)
+	}
+	if got.ID != 2 {
+		t.Errorf("FindMatchingAccount() = account %d, want 2", got.ID)
+	}
+}
+
+func TestFindMatchingAccountWithoutInstitutionIgnoresSuffixMatches(t *testing.T) {
+	accounts := []*pocketsmith.Account{
+		{ID: 1, Title: "PayPay - Cash Wallet"},
+	}
+
+	got, err := FindMatchingAccount(accounts, "", "Cash Wallet", BuildDisplayAccountName("", "Cash Wallet"))
+	if err != pocketsmith.ErrNotFound {
+		t.Errorf("FindMatchingAccount() = %+v, %v, want ErrNotFound", got, err)
+	}
+}
+
+func TestFindMatchingAccountByNumber(t *testing.T) {
+	rakuten := pocketsmith.TransactionAccount{Institution: pocketsmith.Institution{Title: "Rakuten Bank"}}
+	accounts := []*pocketsmith.Account{
+		{ID: 1, Title: "Main ***4567", CurrencyCode: "jpy", PrimaryTransactionAccount: rakuten},
+		{ID: 2, Title: "Main ***4567 - VTI", CurrencyCode: "usd", PrimaryTransactionAccount: rakuten},
+		{ID: 3, Title: "Savings (9990001)", CurrencyCode: "jpy", PrimaryTransactionAccount: rakuten},
+		{ID: 4, Title: "Savings ***4567", CurrencyCode: "usd", PrimaryTransactionAccount: rakuten},
+	}
+
+	tests := []struct {
+		name     string
+		currency string
+		number   string
+		suffix   string
+		want     int
+	}{
+		{"masked number", "JPY", "1234567", "", 1},
+		{"full number", "JPY", "9990001", "", 3},
+		{"holding", "", "1234567", " - VTI", 2},
+		{"other currency", "EUR", "1234567", "", 0},
+		{"number too short", "JPY", "567", "", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FindMatchingAccountByNumber(accounts, "Rakuten Bank", tt.currency, tt.number, tt.suffix)
+			if tt.want == 0 {
+				if err != pocketsmith.ErrNotFound {
+					t.Errorf("FindMatchingAccountByNumber() = %+v, %v, want ErrNotFound", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("FindMatchingAccountByNumber() error = %v", err)
+			}
+			if got.ID != tt.want {
+				t.Errorf("FindMatchingAccountByNumber() = account %d, want %d", got.ID, tt.want)
+			}
+		})
+	}
+}
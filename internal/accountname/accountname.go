@@ -0,0 +1,75 @@
+// Package accountname renders Pocketsmith account titles from a user-defined
+// text/template.
+package accountname
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+)
+
+// Data is what a naming template can use.
+type Data struct {
+	// Institution is the bank or card issuer, empty for cash wallets.
+	Institution string
+	// Name is the account name at the institution.
+	Name       string
+	Nickname   string
+	BranchName string
+	// Number is the account number with all but the last four digits
+	// masked, e.g. "***4567".
+	Number      string
+	Currency    string
+	AccountType string
+	SubType     string
+}
+
+type Template struct {
+	tmpl *template.Template
+}
+
+// Parse parses a naming template such as
+// "{{.Institution}} {{or .Nickname .Name}} {{.Number}}".
+func Parse(text string) (*Template, error) {
+	tmpl, err := template.New("account name").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	// catch references to fields that don't exist before the first account.
+	// Empty names are only an error for real accounts, templates may well
+	// render nothing for empty data.
+	if err := tmpl.Execute(io.Discard, Data{}); err != nil {
+		return nil, err
+	}
+
+	return &Template{tmpl: tmpl}, nil
+}
+
+// Execute renders the title of an account. Runs of whitespace are collapsed,
+// so empty fields don't leave gaps.
+func (t *Template) Execute(data Data) (string, error) {
+	var b strings.Builder
+	if err := t.tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+
+	name := strings.Join(strings.Fields(b.String()), " ")
+	if name == "" {
+		return "", fmt.Errorf("account name template rendered an empty name")
+	}
+
+	return name, nil
+}
+
+// MaskNumber hides all but the last four characters of an account number.
+func MaskNumber(number string) string {
+	number = strings.TrimSpace(number)
+	runes := []rune(number)
+	if len(runes) <= 4 {
+		return number
+	}
+
+	return strings.Repeat("*", len(runes)-4) + string(runes[len(runes)-4:])
+}
@@ -0,0 +1,56 @@
+package accountname
+
+import "testing"
+
+func TestTemplateExecute(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		data     Data
+		want     string
+	}{
+		{
+			name:     "nickname with masked number",
+			template: "{{or .Nickname .Name}} {{.Number}}",
+			data:     Data{Name: "普通預金", Nickname: "Main", Number: MaskNumber("1234567")},
+			want:     "Main ***4567",
+		},
+		{
+			name:     "falls back to the name and collapses empty fields",
+			template: "{{.Institution}} {{or .Nickname .Name}} {{.BranchName}} ({{.Currency}})",
+			data:     Data{Name: "Wallet", Currency: "JPY"},
+			want:     "Wallet (JPY)",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := Parse(tt.template)
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			got, err := tmpl.Execute(tt.data)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("Execute() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRejectsUnknownFields(t *testing.T) {
+	if _, err := Parse("{{.AccountNumber}}"); err == nil {
+		t.Error("Parse() with an unknown field succeeded, want an error")
+	}
+}
+
+func TestParseAcceptsTemplatesOfOptionalFields(t *testing.T) {
+	for _, text := range []string{"{{.Nickname}}", "{{.BranchName}} {{.Number}}"} {
+		if _, err := Parse(text); err != nil {
+			t.Errorf("Parse(%q) error = %v", text, err)
+		}
+	}
+}
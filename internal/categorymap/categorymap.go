@@ -0,0 +1,212 @@
+// Package categorymap translates Moneytree categories into Pocketsmith
+// categories, using a user-editable mapping file and optionally creating
+// missing Pocketsmith categories.
+package categorymap
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+	"github.com/dvcrn/pocketsmith-go"
+)
+
+// File is the user-editable mapping file.
+type File struct {
+	// Categories maps a Moneytree category, by ID or name, to the title of a
+	// Pocketsmith category. An empty title leaves transactions in that
+	// category uncategorised.
+	Categories map[string]string `json:"categories"`
+}
+
+// LoadFile reads a mapping file. The error wraps os.ErrNotExist when the file
+// doesn't exist.
+func LoadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing category map %s: %w", path, err)
+	}
+
+	return &file, nil
+}
+
+// WriteTemplate writes a mapping file listing every Moneytree category by
+// name with an empty target, as a starting point for editing.
+func WriteTemplate(path string, categories []moneytree.MTCategory) error {
+	file := File{Categories: map[string]string{}}
+	for _, category := range categories {
+		file.Categories[category.Name] = ""
+	}
+
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0o644)
+}
+
+// Creator creates Pocketsmith categories. Implemented by pocketsmithx.Client.
+type Creator interface {
+	CreateCategory(userID int, title string, parentID int) (*pocketsmith.Category, error)
+}
+
+type result struct {
+	id  int
+	err error
+}
+
+type Mapper struct {
+	userID     int
+	file       *File
+	creator    Creator
+	autoCreate bool
+
+	mtCategories map[int]moneytree.MTCategory
+	psByTitle    map[string]*pocketsmith.Category
+	resolved     map[int]result
+}
+
+// NewMapper builds a mapper. file may be nil to rely on name mirroring only.
+// With autoCreate, Pocketsmith categories that don't exist yet are created
+// through creator, otherwise transactions in them stay uncategorised.
+func NewMapper(userID int, mtCategories []moneytree.MTCategory, psCategories []*pocketsmith.Category, file *File, creator Creator, autoCreate bool) *Mapper {
+	m := &Mapper{
+		userID:       userID,
+		file:         file,
+		creator:      creator,
+		autoCreate:   autoCreate,
+		mtCategories: map[int]moneytree.MTCategory{},
+		psByTitle:    map[string]*pocketsmith.Category{},
+		resolved:     map[int]result{},
+	}
+
+	for _, category := range mtCategories {
+		m.mtCategories[category.ID] = category
+	}
+
+	var index func([]*pocketsmith.Category)
+	index = func(categories []*pocketsmith.Category) {
+		for _, category := range categories {
+			if _, ok := m.psByTitle[normalize(category.Title)]; !ok {
+				m.psByTitle[normalize(category.Title)] = category
+			}
+			index(category.Children)
+		}
+	}
+	index(psCategories)
+
+	return m
+}
+
+func normalize(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
+
+// CategoryID returns the Pocketsmith category ID for a Moneytree category, or
+// 0 to leave the transaction uncategorised. Results are cached, so an error
+// for a category is only returned once.
+func (m *Mapper) CategoryID(mtCategoryID int) (int, error) {
+	if r, ok := m.resolved[mtCategoryID]; ok {
+		return r.id, nil
+	}
+
+	id, err := m.resolve(mtCategoryID)
+	m.resolved[mtCategoryID] = result{id: id, err: err}
+
+	return id, err
+}
+
+func (m *Mapper) resolve(mtCategoryID int) (int, error) {
+	category, ok := m.mtCategories[mtCategoryID]
+	if !ok {
+		return 0, nil
+	}
+
+	// the mapping file wins, falling back to whatever the parent is mapped to
+	for c, ok := category, true; ok; c, ok = m.parent(c) {
+		if title, found := m.lookupFile(c); found {
+			if title == "" {
+				return 0, nil
+			}
+			if _, exists := m.psByTitle[normalize(title)]; !exists && !m.autoCreate {
+				return 0, fmt.Errorf("Pocketsmith category %q from the category map doesn't exist", title)
+			}
+			return m.ensure(title, 0)
+		}
+	}
+
+	// no mapping, mirror the Moneytree category by name
+	return m.mirror(category)
+}
+
+func (m *Mapper) parent(category moneytree.MTCategory) (moneytree.MTCategory, bool) {
+	if category.ParentID == nil {
+		return moneytree.MTCategory{}, false
+	}
+
+	parent, ok := m.mtCategories[*category.ParentID]
+	return parent, ok
+}
+
+func (m *Mapper) lookupFile(category moneytree.MTCategory) (string, bool) {
+	if m.file == nil {
+		return "", false
+	}
+
+	for _, key := range []string{strconv.Itoa(category.ID), category.Name, category.LocaleName} {
+		if key == "" {
+			continue
+		}
+		if title, ok := m.file.Categories[key]; ok {
+			return strings.TrimSpace(title), true
+		}
+	}
+
+	return "", false
+}
+
+// mirror finds or creates a Pocketsmith category named like the Moneytree
+// one, nested under its mirrored parent.
+func (m *Mapper) mirror(category moneytree.MTCategory) (int, error) {
+	parentID := 0
+	if parent, ok := m.parent(category); ok && m.autoCreate {
+		if _, exists := m.psByTitle[normalize(category.Name)]; !exists {
+			id, err := m.mirror(parent)
+			if err != nil {
+				return 0, err
+			}
+			parentID = id
+		}
+	}
+
+	return m.ensure(category.Name, parentID)
+}
+
+// ensure returns the Pocketsmith category with the given title, creating it
+// under parentID when allowed.
+func (m *Mapper) ensure(title string, parentID int) (int, error) {
+	if existing, ok := m.psByTitle[normalize(title)]; ok {
+		return existing.ID, nil
+	}
+
+	if !m.autoCreate {
+		return 0, nil
+	}
+
+	created, err := m.creator.CreateCategory(m.userID, title, parentID)
+	if err != nil {
+		return 0, fmt.Errorf("creating Pocketsmith category %q: %w", title, err)
+	}
+
+	m.psByTitle[normalize(title)] = created
+	return created.ID, nil
+}
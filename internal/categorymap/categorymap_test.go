@@ -0,0 +1,72 @@
+package categorymap
+
+import (
+	"testing"
+
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+	"github.com/dvcrn/pocketsmith-go"
+)
+
+type fakeCreator struct {
+	nextID  int
+	created []string
+}
+
+func (f *fakeCreator) CreateCategory(userID int, title string, parentID int) (*pocketsmith.Category, error) {
+	f.nextID++
+	f.created = append(f.created, title)
+	return &pocketsmith.Category{ID: 1000 + f.nextID, Title: title, ParentID: parentID}, nil
+}
+
+func TestMapperCategoryID(t *testing.T) {
+	food := 1
+	mtCategories := []moneytree.MTCategory{
+		{ID: 1, Name: "Food"},
+		{ID: 2, Name: "Groceries", ParentID: &food},
+		{ID: 3, Name: "Restaurants", ParentID: &food},
+		{ID: 4, Name: "Transfers"},
+		{ID: 5, Name: "Hobbies"},
+	}
+	psCategories := []*pocketsmith.Category{
+		{ID: 10, Title: "Eating Out"},
+		{ID: 11, Title: "Shopping", Children: []*pocketsmith.Category{{ID: 12, Title: "groceries"}}},
+	}
+	file := &File{Categories: map[string]string{
+		"Food":      "Eating Out",
+		"2":         "Groceries",
+		"Transfers": "",
+	}}
+
+	tests := []struct {
+		name       string
+		autoCreate bool
+		mtID       int
+		want       int
+		wantCreate []string
+	}{
+		{"mapped by id to nested category", false, 2, 12, nil},
+		{"falls back to parent mapping", false, 3, 10, nil},
+		{"explicitly uncategorised", false, 4, 0, nil},
+		{"unknown moneytree category", false, 99, 0, nil},
+		{"unmapped without auto-create", false, 5, 0, nil},
+		{"unmapped with auto-create mirrors name", true, 5, 1001, []string{"Hobbies"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			creator := &fakeCreator{}
+			mapper := NewMapper(1, mtCategories, psCategories, file, creator, tt.autoCreate)
+
+			got, err := mapper.CategoryID(tt.mtID)
+			if err != nil {
+				t.Fatalf("CategoryID() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("CategoryID() = %d, want %d", got, tt.want)
+			}
+			if len(creator.created) != len(tt.wantCreate) {
+				t.Errorf("created %v, want %v", creator.created, tt.wantCreate)
+			}
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Package classify decides whether a Moneytree transaction is income, an
+// expense or a transfer, from user-defined keyword rules and the expense type
+// Moneytree assigned.
+package classify
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+)
+
+type Kind string
+
+const (
+	Income   Kind = "income"
+	Expense  Kind = "expense"
+	Transfer Kind = "transfer"
+)
+
+// Rule classifies every transaction whose description contains Contains as
+// Kind.
+type Rule struct {
+	Contains string `json:"contains"`
+	Kind     Kind   `json:"kind"`
+}
+
+// File is the user-editable rules file. Rules are tried in order and the
+// first match wins.
+type File struct {
+	Rules []Rule `json:"rules"`
+}
+
+// LoadFile reads and validates a rules file.
+func LoadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing classification rules %s: %w", path, err)
+	}
+
+	for i, rule := range file.Rules {
+		if strings.TrimSpace(rule.Contains) == "" {
+			return nil, fmt.Errorf("classification rule %d in %s has no keyword", i+1, path)
+		}
+		switch rule.Kind {
+		case Income, Expense, Transfer:
+		default:
+			return nil, fmt.Errorf("classification rule %d in %s has unknown kind %q, use income, expense or transfer", i+1, path, rule.Kind)
+		}
+	}
+
+	return &file, nil
+}
+
+// Decision is the classification of a transaction and what it was based on.
+type Decision struct {
+	Kind Kind
+	// Reason is "rule:<keyword>", "moneytree", "moneytree-predicted" or
+	// "amount".
+	Reason string
+}
+
+type Classifier struct {
+	rules []Rule
+}
+
+// New returns a classifier using rules from file, which may be nil to rely on
+// Moneytree alone.
+func New(file *File) *Classifier {
+	c := &Classifier{}
+	if file != nil {
+		c.rules = file.Rules
+	}
+
+	return c
+}
+
+// Classify decides the kind of tx. Keyword rules win, then the expense type in
+// Moneytree, then the type Moneytree predicted. Only when both are unknown
+// does the sign of the amount decide.
+func (c *Classifier) Classify(tx *moneytree.MTTransaction) Decision {
+	for _, rule := range c.rules {
+		for _, description := range []string{tx.DescriptionGuest, tx.DescriptionPretty, tx.DescriptionRaw} {
+			if description != "" && strings.Contains(description, rule.Contains) {
+				return Decision{Kind: rule.Kind, Reason: "rule:" + rule.Contains}
+			}
+		}
+	}
+
+	expenseType, reason := tx.ExpenseType, "moneytree"
+	if expenseType == nil || (tx.PredictedExpenseType != nil && *tx.PredictedExpenseType == *expenseType) {
+		// the guest didn't classify it in the app, or agreed with the prediction
+		expenseType, reason = tx.PredictedExpenseType, "moneytree-predicted"
+	}
+
+	if expenseType != nil {
+		switch *expenseType {
+		case moneytree.MTExpenseTypeTransfer:
+			return Decision{Kind: Transfer, Reason: reason}
+		case moneytree.MTExpenseTypeIncome:
+			return Decision{Kind: Income, Reason: reason}
+		case moneytree.MTExpenseTypeExpense:
+			return Decision{Kind: Expense, Reason: reason}
+		}
+	}
+
+	if tx.Amount > 0 {
+		return Decision{Kind: Income, Reason: "amount"}
+	}
+
+	return Decision{Kind: Expense, Reason: "amount"}
+}
+
+// Memo is the marker recorded in the Pocketsmith memo so the decision can be
+// audited later.
+func (d Decision) Memo() string {
+	return fmt.Sprintf("kind=%s(%s)", d.Kind, d.Reason)
+}
@@ -0,0 +1,73 @@
+package classify
+
+import (
+	"testing"
+
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+)
+
+func expenseType(t int) *int {
+	return &t
+}
+
+func TestClassify(t *testing.T) {
+	c := New(&File{Rules: []Rule{
+		{Contains: "ﾔﾁﾝ", Kind: Expense},
+		{Contains: "ｷﾕｳﾖ", Kind: Income},
+	}})
+
+	tests := []struct {
+		name string
+		tx   moneytree.MTTransaction
+		want Decision
+	}{
+		{
+			name: "rent paid by bank transfer is an expense by rule",
+			tx:   moneytree.MTTransaction{Amount: -80000, DescriptionRaw: "振込 ﾔﾁﾝ", ExpenseType: expenseType(moneytree.MTExpenseTypeTransfer), PredictedExpenseType: expenseType(moneytree.MTExpenseTypeTransfer)},
+			want: Decision{Kind: Expense, Reason: "rule:ﾔﾁﾝ"},
+		},
+		{
+			name: "salary is income by rule",
+			tx:   moneytree.MTTransaction{Amount: 250000, DescriptionRaw: "振込 ｷﾕｳﾖ"},
+			want: Decision{Kind: Income, Reason: "rule:ｷﾕｳﾖ"},
+		},
+		{
+			name: "moneytree transfer",
+			tx:   moneytree.MTTransaction{Amount: -30000, DescriptionRaw: "振込 ｼﾞﾌﾞﾝ", ExpenseType: expenseType(moneytree.MTExpenseTypeTransfer), PredictedExpenseType: expenseType(moneytree.MTExpenseTypeTransfer)},
+			want: Decision{Kind: Transfer, Reason: "moneytree-predicted"},
+		},
+		{
+			name: "reclassified by the guest",
+			tx:   moneytree.MTTransaction{Amount: 5000, DescriptionRaw: "ATM", ExpenseType: expenseType(moneytree.MTExpenseTypeTransfer), PredictedExpenseType: expenseType(moneytree.MTExpenseTypeIncome)},
+			want: Decision{Kind: Transfer, Reason: "moneytree"},
+		},
+		{
+			name: "a refund stays an expense",
+			tx:   moneytree.MTTransaction{Amount: 1200, DescriptionRaw: "AMAZON", ExpenseType: expenseType(moneytree.MTExpenseTypeExpense), PredictedExpenseType: expenseType(moneytree.MTExpenseTypeExpense)},
+			want: Decision{Kind: Expense, Reason: "moneytree-predicted"},
+		},
+		{
+			name: "unknown expense type falls back to the amount",
+			tx:   moneytree.MTTransaction{Amount: 300, DescriptionRaw: "ﾘｿｸ", ExpenseType: expenseType(9), PredictedExpenseType: expenseType(9)},
+			want: Decision{Kind: Income, Reason: "amount"},
+		},
+		{
+			name: "missing expense type uses the prediction",
+			tx:   moneytree.MTTransaction{Amount: 30000, DescriptionRaw: "振込 ｼﾞﾌﾞﾝ", PredictedExpenseType: expenseType(moneytree.MTExpenseTypeTransfer)},
+			want: Decision{Kind: Transfer, Reason: "moneytree-predicted"},
+		},
+		{
+			name: "missing expense type falls back to the amount",
+			tx:   moneytree.MTTransaction{Amount: 300, DescriptionRaw: "ﾘｿｸ"},
+			want: Decision{Kind: Income, Reason: "amount"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.Classify(&tt.tx); got != tt.want {
+				t.Errorf("Classify() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
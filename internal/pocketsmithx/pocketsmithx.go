@@ -0,0 +1,109 @@
+// Package pocketsmithx covers the Pocketsmith API endpoints that
+// github.com/dvcrn/pocketsmith-go doesn't implement yet.
+package pocketsmithx
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/dvcrn/pocketsmith-go"
+)
+
+const baseURL = "https://api.pocketsmith.com/v2"
+
+type Client struct {
+	token      string
+	httpClient *http.Client
+}
+
+func NewClient(token string) *Client {
+	return &Client{
+		token:      token,
+		httpClient: &http.Client{},
+	}
+}
+
+// do sends a request and decodes the JSON response into out, if given.
+// Errors are returned as pocketsmith.ApiError like pocketsmith-go does.
+func (c *Client) do(method, url string, body interface{}, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		payload, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(payload)
+	}
+
+	req, err := http.NewRequest(method, url, reqBody)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Developer-Key", c.token)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		var apiErr pocketsmith.ApiError
+		if err := json.Unmarshal(respBody, &apiErr); err == nil && apiErr.Err != "" {
+			return apiErr
+		}
+		return fmt.Errorf("pocketsmith: %s %s returned %d", method, req.URL.Path, resp.StatusCode)
+	}
+
+	if out == nil || len(respBody) == 0 {
+		return nil
+	}
+
+	return json.Unmarshal(respBody, out)
+}
+
+// ListCategories returns the user's category tree. Subcategories are in
+// Children of their parent.
+func (c *Client) ListCategories(userID int) ([]*pocketsmith.Category, error) {
+	var categories []*pocketsmith.Category
+	if err := c.do("GET", fmt.Sprintf("%s/users/%d/categories", baseURL, userID), nil, &categories); err != nil {
+		return nil, err
+	}
+
+	return categories, nil
+}
+
+// CreateCategory creates a category, as a subcategory of parentID if it's
+// not 0.
+func (c *Client) CreateCategory(userID int, title string, parentID int) (*pocketsmith.Category, error) {
+	payload := struct {
+		Title    string `json:"title"`
+		ParentID int    `json:"parent_id,omitempty"`
+	}{
+		Title:    title,
+		ParentID: parentID,
+	}
+
+	var category pocketsmith.Category
+	if err := c.do("POST", fmt.Sprintf("%s/users/%d/categories", baseURL, userID), payload, &category); err != nil {
+		return nil, err
+	}
+
+	return &category, nil
+}
+
+// DeleteTransaction deletes a transaction.
+func (c *Client) DeleteTransaction(transactionID int64) error {
+	return c.do("DELETE", fmt.Sprintf("%s/transactions/%d", baseURL, transactionID), nil, nil)
+}
@@ -0,0 +1,329 @@
+package syncstate
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/dvcrn/pocketsmith-anapay/internal/atomicfile"
+)
+
+const dateLayout = "2006-01-02"
+
+// AccountState is what's remembered about a Moneytree account between runs.
+type AccountState struct {
+	// LastTransactionDate is the newest transaction date (YYYY-MM-DD) synced
+	// so far.
+	LastTransactionDate string `json:"last_transaction_date,omitempty"`
+	// LastUpdatedAt is the newest Moneytree updated_at seen so far.
+	LastUpdatedAt string `json:"last_updated_at,omitempty"`
+	// PayeesCheckedAt is when the Pocketsmith transactions of the account
+	// were last checked for edited payees (RFC 3339).
+	PayeesCheckedAt string `json:"payees_checked_at,omitempty"`
+}
+
+// PositionSnapshot is the valuation of a single holding on a given day.
+type PositionSnapshot struct {
+	Date        string  `json:"date"`
+	Ticker      string  `json:"ticker"`
+	Name        string  `json:"name"`
+	Currency    string  `json:"currency"`
+	Quantity    float64 `json:"quantity"`
+	MarketValue float64 `json:"market_value"`
+	CostBasis   float64 `json:"cost_basis"`
+	Profit      float64 `json:"profit"`
+}
+
+// PendingClaim is a card transaction that was pushed to Pocketsmith while it
+// may still have been a pending authorization. It is tracked until it either
+// posts or disappears from Moneytree.
+type PendingClaim struct {
+	AccountID        int    `json:"account_id"`
+	RawTransactionID int    `json:"raw_transaction_id"`
+	PocketsmithID    int64  `json:"pocketsmith_id"`
+	Date             string `json:"date"`
+}
+
+// ClosedAccount is what the sync changed on the Pocketsmith account of a
+// closed Moneytree account, so it can be undone when the account reopens.
+type ClosedAccount struct {
+	PocketsmithID int `json:"pocketsmith_id"`
+	// IsNetWorth is whether the account counted towards net worth before it
+	// was closed.
+	IsNetWorth bool `json:"is_net_worth"`
+}
+
+// State is the sync state persisted between runs, keyed by Moneytree account
+// ID.
+type State struct {
+	Accounts map[int]*AccountState `json:"accounts"`
+	// Positions is the valuation history of each stock account's holdings,
+	// oldest first.
+	Positions map[int][]PositionSnapshot `json:"positions,omitempty"`
+	// Attachments maps Moneytree attachment IDs to the Pocketsmith
+	// attachments they were uploaded as.
+	Attachments map[int]int64 `json:"attachments,omitempty"`
+	// Claims are the possibly pending card transactions, keyed by Moneytree
+	// claim ID.
+	Claims map[int]*PendingClaim `json:"claims,omitempty"`
+	// Links maps Moneytree account IDs to the Pocketsmith accounts they sync
+	// into, so accounts are found again regardless of their titles.
+	Links map[int]int `json:"links,omitempty"`
+	// LinkTitles are the titles the sync last gave linked Pocketsmith
+	// accounts, keyed by Moneytree account ID, to tell them from titles
+	// chosen in Pocketsmith.
+	LinkTitles map[int]string `json:"link_titles,omitempty"`
+	// Closed are the accounts the sync marked as closed, keyed by Moneytree
+	// account ID.
+	Closed map[int]*ClosedAccount `json:"closed,omitempty"`
+
+	path string
+}
+
+// Load reads the state file at path. A missing file yields an empty state.
+func Load(path string) (*State, error) {
+	s := &State{
+		Accounts:    map[int]*AccountState{},
+		Positions:   map[int][]PositionSnapshot{},
+		Attachments: map[int]int64{},
+		Claims:      map[int]*PendingClaim{},
+		Links:       map[int]int{},
+		LinkTitles:  map[int]string{},
+		Closed:      map[int]*ClosedAccount{},
+		path:        path,
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return s, nil
+		}
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, s); err != nil {
+		return nil, err
+	}
+	if s.Accounts == nil {
+		s.Accounts = map[int]*AccountState{}
+	}
+	if s.Positions == nil {
+		s.Positions = map[int][]PositionSnapshot{}
+	}
+	if s.Attachments == nil {
+		s.Attachments = map[int]int64{}
+	}
+	if s.Claims == nil {
+		s.Claims = map[int]*PendingClaim{}
+	}
+	if s.Links == nil {
+		s.Links = map[int]int{}
+	}
+	if s.LinkTitles == nil {
+		s.LinkTitles = map[int]string{}
+	}
+	if s.Closed == nil {
+		s.Closed = map[int]*ClosedAccount{}
+	}
+
+	return s, nil
+}
+
+// Save writes the state back to the file it was loaded from.
+func (s *State) Save() error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(s.path, data, 0o600)
+}
+
+// Account returns the state of a Moneytree account, creating it if needed.
+func (s *State) Account(moneytreeAccountID int) *AccountState {
+	account, ok := s.Accounts[moneytreeAccountID]
+	if !ok {
+		account = &AccountState{}
+		s.Accounts[moneytreeAccountID] = account
+	}
+
+	return account
+}
+
+// RecordPositions adds the holdings of a stock account to its history.
+// Snapshots taken earlier on the same day are replaced, so the history keeps
+// one valuation per holding per day.
+func (s *State) RecordPositions(moneytreeAccountID int, snapshots []PositionSnapshot) {
+	history := s.Positions[moneytreeAccountID]
+	for _, snapshot := range snapshots {
+		history = slices.DeleteFunc(history, func(existing PositionSnapshot) bool {
+			return existing.Date == snapshot.Date && existing.Ticker == snapshot.Ticker && existing.Name == snapshot.Name
+		})
+		history = append(history, snapshot)
+	}
+
+	s.Positions[moneytreeAccountID] = history
+}
+
+// LatestPositions returns the most recent snapshot of every holding the
+// account ever had, including ones that have since been sold.
+func (s *State) LatestPositions(moneytreeAccountID int) []PositionSnapshot {
+	latest := map[string]int{}
+	var out []PositionSnapshot
+	for _, snapshot := range s.Positions[moneytreeAccountID] {
+		key := snapshot.Ticker + "\x00" + snapshot.Name
+		if i, ok := latest[key]; ok {
+			if snapshot.Date >= out[i].Date {
+				out[i] = snapshot
+			}
+			continue
+		}
+
+		latest[key] = len(out)
+		out = append(out, snapshot)
+	}
+
+	return out
+}
+
+// TrackClaim remembers a card transaction that may still be pending. A claim
+// already tracked for a different Pocketsmith transaction is kept, since only
+// one of the two can be expired later; ok is false and existing is that claim.
+func (s *State) TrackClaim(claimID int, claim PendingClaim) (existing *PendingClaim, ok bool) {
+	if tracked := s.Claims[claimID]; tracked != nil && tracked.PocketsmithID != claim.PocketsmithID {
+		return tracked, false
+	}
+
+	s.Claims[claimID] = &claim
+	return &claim, true
+}
+
+// ResolveClaim stops tracking a claim, because it posted or was removed.
+func (s *State) ResolveClaim(claimID int) {
+	delete(s.Claims, claimID)
+}
+
+// OverdueClaims returns the claims of a Moneytree account dated before
+// cutoff, keyed by claim ID.
+func (s *State) OverdueClaims(moneytreeAccountID int, cutoff time.Time) map[int]*PendingClaim {
+	overdue := map[int]*PendingClaim{}
+	for claimID, claim := range s.Claims {
+		if claim.AccountID == moneytreeAccountID && claim.Date < cutoff.Format(dateLayout) {
+			overdue[claimID] = claim
+		}
+	}
+
+	return overdue
+}
+
+// Link records that a Moneytree account syncs into a Pocketsmith account.
+// The title of an earlier linked account is forgotten.
+func (s *State) Link(moneytreeAccountID, pocketsmithAccountID int) {
+	if s.Links[moneytreeAccountID] != pocketsmithAccountID {
+		delete(s.LinkTitles, moneytreeAccountID)
+	}
+	s.Links[moneytreeAccountID] = pocketsmithAccountID
+}
+
+// Unlink forgets the Pocketsmith account of a Moneytree account. It reports
+// whether there was a link.
+func (s *State) Unlink(moneytreeAccountID int) bool {
+	_, ok := s.Links[moneytreeAccountID]
+	delete(s.Links, moneytreeAccountID)
+	delete(s.LinkTitles, moneytreeAccountID)
+
+	return ok
+}
+
+// SetLinkTitle records the title the sync gave the linked account of a
+// Moneytree account.
+func (s *State) SetLinkTitle(moneytreeAccountID int, title string) {
+	s.LinkTitles[moneytreeAccountID] = title
+}
+
+// LinkTitle returns the title the sync last gave the linked account of a
+// Moneytree account.
+func (s *State) LinkTitle(moneytreeAccountID int) (string, bool) {
+	title, ok := s.LinkTitles[moneytreeAccountID]
+	return title, ok
+}
+
+// LinkedAccount returns the Pocketsmith account a Moneytree account is linked
+// to.
+func (s *State) LinkedAccount(moneytreeAccountID int) (int, bool) {
+	id, ok := s.Links[moneytreeAccountID]
+	return id, ok
+}
+
+// MarkClosed records what closing a Moneytree account changed. An account
+// that is already marked keeps its record, which has the settings from
+// before the first close.
+func (s *State) MarkClosed(moneytreeAccountID int, closed ClosedAccount) {
+	if _, ok := s.Closed[moneytreeAccountID]; ok {
+		return
+	}
+
+	s.Closed[moneytreeAccountID] = &closed
+}
+
+// ClosedAccount returns the record of a Moneytree account the sync marked as
+// closed.
+func (s *State) ClosedAccount(moneytreeAccountID int) (*ClosedAccount, bool) {
+	closed, ok := s.Closed[moneytreeAccountID]
+	return closed, ok
+}
+
+// Reopen forgets that a Moneytree account was closed.
+func (s *State) Reopen(moneytreeAccountID int) {
+	delete(s.Closed, moneytreeAccountID)
+}
+
+// Since returns the date to fetch transactions from: lookback before the
+// older of the two high-water marks, so transactions that post late or get
+// edited after the fact are still picked up. ok is false when nothing has
+// been synced yet.
+func (a *AccountState) Since(lookback time.Duration) (since string, ok bool) {
+	var mark time.Time
+	for _, value := range []string{a.LastTransactionDate, a.LastUpdatedAt} {
+		t, err := parseDate(value)
+		if err != nil {
+			continue
+		}
+		if mark.IsZero() || t.Before(mark) {
+			mark = t
+		}
+	}
+
+	if mark.IsZero() {
+		return "", false
+	}
+
+	return mark.Add(-lookback).Format(dateLayout), true
+}
+
+// Advance moves the high-water marks forward to include a synced transaction.
+// Marks never move backwards.
+func (a *AccountState) Advance(date time.Time, updatedAt string) {
+	if d := date.Format(dateLayout); d > a.LastTransactionDate {
+		a.LastTransactionDate = d
+	}
+
+	if updated, err := time.Parse(time.RFC3339, updatedAt); err == nil {
+		current, err := time.Parse(time.RFC3339, a.LastUpdatedAt)
+		if err != nil || updated.After(current) {
+			a.LastUpdatedAt = updatedAt
+		}
+	}
+}
+
+// parseDate accepts either a plain date or an RFC 3339 timestamp and returns
+// the calendar date.
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC), nil
+	}
+
+	return time.Parse(dateLayout, value)
+}
@@ -0,0 +1,147 @@
+package syncstate
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAccountStateSince(t *testing.T) {
+	account := &AccountState{}
+	if _, ok := account.Since(7 * 24 * time.Hour); ok {
+		t.Fatal("Since() on empty state reported a mark")
+	}
+
+	account.Advance(time.Date(2025, 3, 10, 0, 0, 0, 0, time.UTC), "2025-03-12T09:00:00+09:00")
+	account.Advance(time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC), "2025-03-01T09:00:00+09:00")
+
+	if account.LastTransactionDate != "2025-03-10" || account.LastUpdatedAt != "2025-03-12T09:00:00+09:00" {
+		t.Errorf("marks moved backwards: %+v", account)
+	}
+
+	since, ok := account.Since(7 * 24 * time.Hour)
+	if !ok || since != "2025-03-03" {
+		t.Errorf("Since() = %q, %v, want 2025-03-03, true", since, ok)
+	}
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	state, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	state.Account(42).LastTransactionDate = "2025-01-01"
+	if err := state.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if got := loaded.Account(42).LastTransactionDate; got != "2025-01-01" {
+		t.Errorf("LastTransactionDate = %q, want 2025-01-01", got)
+	}
+}
+
+func TestRecordPositions(t *testing.T) {
+	state, err := Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	state.RecordPositions(1, []PositionSnapshot{{Date: "2025-01-01", Ticker: "VTI", Quantity: 1, MarketValue: 100}})
+	state.RecordPositions(1, []PositionSnapshot{{Date: "2025-01-02", Ticker: "VTI", Quantity: 1, MarketValue: 110}})
+	state.RecordPositions(1, []PositionSnapshot{{Date: "2025-01-02", Ticker: "VTI", Quantity: 2, MarketValue: 220}})
+
+	if got := len(state.Positions[1]); got != 2 {
+		t.Errorf("history length = %d, want 2 (one per day)", got)
+	}
+
+	latest := state.LatestPositions(1)
+	if len(latest) != 1 || latest[0].MarketValue != 220 {
+		t.Errorf("LatestPositions() = %+v, want the 2025-01-02 valuation of 220", latest)
+	}
+}
+
+func TestOverdueClaims(t *testing.T) {
+	state, err := Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	state.TrackClaim(1, PendingClaim{AccountID: 42, RawTransactionID: 100, Date: "2025-01-01"})
+	state.TrackClaim(2, PendingClaim{AccountID: 42, RawTransactionID: 200, Date: "2025-01-20"})
+	state.TrackClaim(3, PendingClaim{AccountID: 7, RawTransactionID: 300, Date: "2025-01-01"})
+
+	overdue := state.OverdueClaims(42, time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC))
+	if len(overdue) != 1 || overdue[1] == nil || overdue[1].RawTransactionID != 100 {
+		t.Errorf("OverdueClaims() = %v, want only claim 1", overdue)
+	}
+
+	state.ResolveClaim(1)
+	if overdue := state.OverdueClaims(42, time.Date(2025, 1, 15, 0, 0, 0, 0, time.UTC)); len(overdue) != 0 {
+		t.Errorf("OverdueClaims() after ResolveClaim = %v, want none", overdue)
+	}
+}
+
+func TestTrackClaimKeepsConflictingClaim(t *testing.T) {
+	state, err := Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if _, ok := state.TrackClaim(1, PendingClaim{AccountID: 42, RawTransactionID: 100, PocketsmithID: 500, Date: "2025-01-01"}); !ok {
+		t.Fatal("TrackClaim() of a new claim = false, want true")
+	}
+	if _, ok := state.TrackClaim(1, PendingClaim{AccountID: 42, RawTransactionID: 100, PocketsmithID: 500, Date: "2025-01-02"}); !ok {
+		t.Error("TrackClaim() of the same Pocketsmith transaction = false, want true")
+	}
+
+	existing, ok := state.TrackClaim(1, PendingClaim{AccountID: 42, RawTransactionID: 101, PocketsmithID: 501, Date: "2025-01-03"})
+	if ok || existing.PocketsmithID != 500 {
+		t.Errorf("TrackClaim() of another Pocketsmith transaction = %+v, %v, want the existing claim and false", existing, ok)
+	}
+	if got := state.Claims[1].PocketsmithID; got != 500 {
+		t.Errorf("tracked Pocketsmith transaction = %d, want 500 to be kept", got)
+	}
+}
+
+func TestLinksRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	state, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	state.Link(42, 1001)
+	state.SetLinkTitle(42, "Rakuten Bank: Savings")
+	state.Link(43, 1002)
+	state.SetLinkTitle(43, "Wallet")
+	state.Link(43, 1003)
+	if _, ok := state.LinkTitle(43); ok {
+		t.Error("LinkTitle(43) is still set after linking another account")
+	}
+	if !state.Unlink(43) {
+		t.Error("Unlink() of a linked account = false, want true")
+	}
+	if err := state.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if id, ok := loaded.LinkedAccount(42); !ok || id != 1001 {
+		t.Errorf("LinkedAccount(42) = %d, %t, want 1001, true", id, ok)
+	}
+	if _, ok := loaded.LinkedAccount(43); ok {
+		t.Error("LinkedAccount(43) is still linked after Unlink")
+	}
+	if title, ok := loaded.LinkTitle(42); !ok || title != "Rakuten Bank: Savings" {
+		t.Errorf("LinkTitle(42) = %q, %t, want the saved title", title, ok)
+	}
+}
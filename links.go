@@ -0,0 +1,196 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/dvcrn/pocketsmith-anapay/internal/accountmatch"
+	"github.com/dvcrn/pocketsmith-anapay/internal/syncstate"
+	"github.com/dvcrn/pocketsmith-go"
+	"github.com/getsentry/sentry-go"
+)
+
+// lookupAccount finds the Pocketsmith account of a Moneytree account: the
+// linked account if there is one, otherwise by title. linked reports whether
+// the link was used. Accounts linked to other Moneytree accounts never match
+// by title, and links to deleted accounts are dropped.
+func lookupAccount(accounts []*pocketsmith.Account, state *syncstate.State, name accountName) (account *pocketsmith.Account, linked bool, err error) {
+	if state == nil {
+		account, err := matchAccount(accounts, name)
+		return account, false, err
+	}
+
+	if id, ok := state.LinkedAccount(name.moneytreeID); ok && name.moneytreeID != 0 {
+		for _, account := range accounts {
+			if account.ID == id {
+				return account, true, nil
+			}
+		}
+
+		fmt.Printf("Linked Pocketsmith account %d of %s is gone, matching by title again\n", id, name)
+		state.Unlink(name.moneytreeID)
+	}
+
+	taken := map[int]bool{}
+	for moneytreeID, psID := range state.Links {
+		if moneytreeID != name.moneytreeID {
+			taken[psID] = true
+		}
+	}
+	unlinked := slices.DeleteFunc(slices.Clone(accounts), func(account *pocketsmith.Account) bool {
+		return taken[account.ID]
+	})
+
+	account, err = matchAccount(unlinked, name)
+	return account, false, err
+}
+
+// linkAccount remembers the Pocketsmith account a Moneytree account syncs
+// into, when there is a state file to remember it in. Links made from a
+// heuristic match, like a title merely ending in the account name, are
+// called out so a wrong guess doesn't go unnoticed.
+func linkAccount(state *syncstate.State, name accountName, account *pocketsmith.Account) {
+	if state == nil || name.moneytreeID == 0 {
+		return
+	}
+	if id, ok := state.LinkedAccount(name.moneytreeID); ok && id == account.ID {
+		return
+	}
+
+	if hasExactTitle(account, name) {
+		fmt.Printf("Linking Moneytree account %d to Pocketsmith account %d (%s)\n", name.moneytreeID, account.ID, account.Title)
+	} else {
+		fmt.Printf("Warning: linking Moneytree account %d to Pocketsmith account %d (%s), which only has a similar title. If that's the wrong account, fix it with: unlink %d, or link %d <pocketsmith-account-id>\n",
+			name.moneytreeID, account.ID, account.Title, name.moneytreeID, name.moneytreeID)
+	}
+
+	state.Link(name.moneytreeID, account.ID)
+	recordLinkTitle(state, name, account)
+	if err := state.Save(); err != nil {
+		sentry.CaptureException(err)
+		fmt.Println("Error saving account link: ", err)
+	}
+}
+
+// syncedTitle returns the title the sync gives the Pocketsmith account of
+// name. Linked accounts keep titles given in Pocketsmith: only a title that
+// is still the one the sync last gave the account is updated, so a changed
+// naming template carries over. Links made before titles were recorded fall
+// back to recognizing titles of the current template.
+func syncedTitle(state *syncstate.State, name accountName, account *pocketsmith.Account, linked bool) string {
+	if !linked {
+		return name.display
+	}
+
+	generated := isGeneratedTitle(account.Title, name)
+	if last, ok := state.LinkTitle(name.moneytreeID); ok {
+		generated = strings.TrimSuffix(account.Title, closedMarker) == last
+	}
+	if generated {
+		return name.display
+	}
+
+	return account.Title
+}
+
+// recordLinkTitle remembers the title of the linked account of name when it
+// is the one the sync gives it. It reports whether the state changed.
+func recordLinkTitle(state *syncstate.State, name accountName, account *pocketsmith.Account) bool {
+	if state == nil || account.Title != name.display {
+		return false
+	}
+	if id, ok := state.LinkedAccount(name.moneytreeID); !ok || id != account.ID {
+		return false
+	}
+	if last, ok := state.LinkTitle(name.moneytreeID); ok && last == account.Title {
+		return false
+	}
+
+	state.SetLinkTitle(name.moneytreeID, account.Title)
+	return true
+}
+
+// hasExactTitle reports whether account carries one of the titles the sync
+// gives name, as opposed to being matched by a heuristic.
+func hasExactTitle(account *pocketsmith.Account, name accountName) bool {
+	for _, candidate := range name.candidates() {
+		if accountmatch.SameTitle(account.Title, candidate.DisplayName) || accountmatch.SameTitle(account.Title, candidate.BaseName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// runLinkCommand edits the account links in the state file:
+//
+//	link <moneytree-account-id> <pocketsmith-account-id>
+//	unlink <moneytree-account-id>
+//	links
+//
+// It returns the exit code.
+func runLinkCommand(command string, args []string) int {
+	flags := flag.NewFlagSet(command, flag.ContinueOnError)
+	stateFile := flags.String("state-file", os.Getenv("SYNC_STATE_FILE"), "File the sync state is kept in")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	wantArgs := map[string]int{"link": 2, "unlink": 1, "links": 0}[command]
+	if *stateFile == "" || flags.NArg() != wantArgs {
+		fmt.Fprintln(os.Stderr, "usage:")
+		fmt.Fprintln(os.Stderr, "  pocketsmith-moneytree link -state-file=FILE <moneytree-account-id> <pocketsmith-account-id>")
+		fmt.Fprintln(os.Stderr, "  pocketsmith-moneytree unlink -state-file=FILE <moneytree-account-id>")
+		fmt.Fprintln(os.Stderr, "  pocketsmith-moneytree links -state-file=FILE")
+		return 2
+	}
+
+	ids := make([]int, flags.NArg())
+	for i, arg := range flags.Args() {
+		id, err := strconv.Atoi(arg)
+		if err != nil || id <= 0 {
+			fmt.Fprintf(os.Stderr, "invalid account ID %q\n", arg)
+			return 2
+		}
+		ids[i] = id
+	}
+
+	state, err := syncstate.Load(*stateFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error loading sync state: ", err)
+		return 1
+	}
+
+	switch command {
+	case "link":
+		state.Link(ids[0], ids[1])
+		fmt.Printf("Linked Moneytree account %d to Pocketsmith account %d\n", ids[0], ids[1])
+	case "unlink":
+		if !state.Unlink(ids[0]) {
+			fmt.Printf("Moneytree account %d is not linked\n", ids[0])
+			return 0
+		}
+		fmt.Printf("Unlinked Moneytree account %d\n", ids[0])
+	case "links":
+		moneytreeIDs := make([]int, 0, len(state.Links))
+		for moneytreeID := range state.Links {
+			moneytreeIDs = append(moneytreeIDs, moneytreeID)
+		}
+		slices.Sort(moneytreeIDs)
+		for _, moneytreeID := range moneytreeIDs {
+			fmt.Printf("%d -> %d\n", moneytreeID, state.Links[moneytreeID])
+		}
+		return 0
+	}
+
+	if err := state.Save(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error saving sync state: ", err)
+		return 1
+	}
+
+	return 0
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/dvcrn/pocketsmith-anapay/internal/accountname"
+	"github.com/dvcrn/pocketsmith-anapay/internal/syncstate"
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+	"github.com/dvcrn/pocketsmith-go"
+)
+
+func TestLookupAccount(t *testing.T) {
+	name, err := newAccountName(moneytree.MTAccount{ID: 42, InstitutionAccountName: "Savings", InstitutionAccountNumber: "1234567", Currency: "JPY"}, "Rakuten Bank", nil)
+	if err != nil {
+		t.Fatalf("newAccountName() error = %v", err)
+	}
+
+	accounts := []*pocketsmith.Account{
+		{ID: 1, Title: name.display},
+		{ID: 2, Title: "My savings"},
+	}
+
+	tests := []struct {
+		name       string
+		links      map[int]int
+		want       int
+		wantLinked bool
+		wantLinks  map[int]int
+	}{
+		{"matched by title", nil, 1, false, nil},
+		{"link wins over the title", map[int]int{42: 2}, 2, true, map[int]int{42: 2}},
+		{"stale link is dropped", map[int]int{42: 99}, 1, false, nil},
+		{"account linked to another Moneytree account", map[int]int{43: 1}, 0, false, map[int]int{43: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := syncstate.Load(filepath.Join(t.TempDir(), "state.json"))
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			for moneytreeID, psID := range tt.links {
+				state.Link(moneytreeID, psID)
+			}
+
+			got, linked, err := lookupAccount(accounts, state, name)
+			if tt.want == 0 {
+				if err != pocketsmith.ErrNotFound {
+					t.Errorf("lookupAccount() = %+v, %v, want ErrNotFound", got, err)
+				}
+			} else if err != nil {
+				t.Fatalf("lookupAccount() error = %v", err)
+			} else if got.ID != tt.want || linked != tt.wantLinked {
+				t.Errorf("lookupAccount() = account %d, linked %t, want %d, %t", got.ID, linked, tt.want, tt.wantLinked)
+			}
+
+			if len(state.Links) != len(tt.wantLinks) {
+				t.Errorf("links = %v, want %v", state.Links, tt.wantLinks)
+			}
+			for moneytreeID, psID := range tt.wantLinks {
+				if id, ok := state.LinkedAccount(moneytreeID); !ok || id != psID {
+					t.Errorf("links = %v, want %v", state.Links, tt.wantLinks)
+				}
+			}
+		})
+	}
+}
+
+func TestHasExactTitle(t *testing.T) {
+	name, err := newAccountName(moneytree.MTAccount{ID: 42, InstitutionAccountName: "Savings", InstitutionAccountNumber: "1234567", Currency: "JPY"}, "Rakuten Bank", nil)
+	if err != nil {
+		t.Fatalf("newAccountName() error = %v", err)
+	}
+
+	for title, want := range map[string]bool{
+		"Rakuten Bank - Savings (1234567)":          true,
+		"savings  (1234567)":                        true,
+		"Rakuten Bank - Savings (1234567) (closed)": true,
+		"Old Bank - Savings (1234567)":              false,
+	} {
+		if got := hasExactTitle(&pocketsmith.Account{Title: title}, name); got != want {
+			t.Errorf("hasExactTitle(%q) = %t, want %t", title, got, want)
+		}
+	}
+}
+
+func TestSyncedTitleAfterTemplateChange(t *testing.T) {
+	account := moneytree.MTAccount{ID: 42, InstitutionAccountName: "Savings", Nickname: "Main", InstitutionAccountNumber: "1234567", Currency: "JPY"}
+
+	before, err := accountname.Parse("{{.Nickname}} {{.Number}}")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	after, err := accountname.Parse("{{.Institution}}: {{.Name}} {{.Number}}")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	nameA, err := newAccountName(account, "Rakuten Bank", before)
+	if err != nil {
+		t.Fatalf("newAccountName() error = %v", err)
+	}
+	nameB, err := newAccountName(account, "Rakuten Bank", after)
+	if err != nil {
+		t.Fatalf("newAccountName() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		title     string
+		linked    bool
+		lastTitle string
+		want      string
+	}{
+		{"linked account with the title from template A", nameA.display, true, nameA.display, nameB.display},
+		{"linked account marked as closed", nameA.display + closedMarker, true, nameA.display, nameB.display},
+		{"linked account renamed in Pocketsmith", "My savings", true, nameA.display, "My savings"},
+		{"link without a recorded title", nameA.display, true, "", nameA.display},
+		{"unlinked account", nameA.display, false, "", nameB.display},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := syncstate.Load(filepath.Join(t.TempDir(), "state.json"))
+			if err != nil {
+				t.Fatalf("Load() error = %v", err)
+			}
+			if tt.linked {
+				state.Link(42, 1)
+			}
+			if tt.lastTitle != "" {
+				state.SetLinkTitle(42, tt.lastTitle)
+			}
+
+			psAccount := &pocketsmith.Account{ID: 1, Title: tt.title}
+			if got := syncedTitle(state, nameB, psAccount, tt.linked); got != tt.want {
+				t.Errorf("syncedTitle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRecordLinkTitle(t *testing.T) {
+	state, err := syncstate.Load(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	name := accountName{moneytreeID: 42, display: "Rakuten Bank: Savings (1234567)"}
+
+	if recordLinkTitle(state, name, &pocketsmith.Account{ID: 1, Title: name.display}) {
+		t.Error("recordLinkTitle() of an unlinked account = true, want false")
+	}
+
+	state.Link(42, 1)
+	if recordLinkTitle(state, name, &pocketsmith.Account{ID: 1, Title: "My savings"}) {
+		t.Error("recordLinkTitle() of a title chosen in Pocketsmith = true, want false")
+	}
+	if !recordLinkTitle(state, name, &pocketsmith.Account{ID: 1, Title: name.display}) {
+		t.Error("recordLinkTitle() of the generated title = false, want true")
+	}
+	if title, _ := state.LinkTitle(42); title != name.display {
+		t.Errorf("LinkTitle() = %q, want %q", title, name.display)
+	}
+	if recordLinkTitle(state, name, &pocketsmith.Account{ID: 1, Title: name.display}) {
+		t.Error("recordLinkTitle() of an unchanged title = true, want false")
+	}
+}
@@ -1,16 +1,24 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"sort"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
-	"github.com/dvcrn/pocketsmith-anapay/internal/accountmatch"
-	sanitizier "github.com/dvcrn/pocketsmith-anapay/sanitizer"
+	"github.com/dvcrn/pocketsmith-anapay/internal/accountname"
+	"github.com/dvcrn/pocketsmith-anapay/internal/categorymap"
+	"github.com/dvcrn/pocketsmith-anapay/internal/classify"
+	"github.com/dvcrn/pocketsmith-anapay/internal/pocketsmithx"
+	"github.com/dvcrn/pocketsmith-anapay/internal/syncstate"
 	"github.com/getsentry/sentry-go"
 
 	"github.com/dvcrn/pocketsmith-anapay/moneytree"
@@ -45,6 +53,86 @@ type Config struct {
 	MoneytreeApiKey   string
 	PocketsmithToken  string
 
+	// TokenCachePath is where Moneytree tokens are persisted between runs.
+	// Empty disables the cache.
+	TokenCachePath string
+
+	// MoneytreeRegion pins the Moneytree API region (e.g. "jp"). Empty uses
+	// the resource server named at login.
+	MoneytreeRegion string
+	// MoneytreeAuthURL overrides the OAuth server, e.g. to run against
+	// cmd/fake-moneytree. API calls follow the resource server it returns.
+	MoneytreeAuthURL string
+
+	// MaxRetries is how often failed Moneytree GET requests are retried.
+	MaxRetries int
+
+	// RefreshTimeout is how long to wait for Moneytree to finish refreshing
+	// credentials before syncing whatever is there.
+	RefreshTimeout time.Duration
+
+	// RefreshInstitutions and RefreshCredentialIDs limit the refresh to these
+	// institutions / Moneytree credentials. Empty refreshes everything.
+	RefreshInstitutions  []string
+	RefreshCredentialIDs []int
+
+	// StateFile is where per-account sync progress is kept between runs.
+	// Empty disables incremental sync.
+	StateFile string
+	// FullSync ignores the saved progress and re-scans all transactions.
+	FullSync bool
+	// LookbackDays is how far before the last synced transaction an
+	// incremental sync starts, to catch transactions that post late.
+	LookbackDays int
+
+	// SyncPositions mirrors the holdings of stock accounts into one
+	// Pocketsmith account per holding.
+	SyncPositions bool
+
+	// SyncPoints values point-program accounts in the base currency using
+	// PointRates.
+	SyncPoints bool
+	PointRates []pointRate
+
+	// CategoryMapPath is a JSON file mapping Moneytree categories to
+	// Pocketsmith categories.
+	CategoryMapPath string
+	// CreateCategories creates Pocketsmith categories that don't exist yet
+	// instead of leaving the transactions uncategorised.
+	CreateCategories bool
+
+	// ClassificationRulesPath is a JSON file of keyword rules deciding
+	// whether a transaction is income, an expense or a transfer.
+	ClassificationRulesPath string
+
+	// PendingWindow is how long a pending card transaction may take to post
+	// before it's deleted from Pocketsmith. Needs StateFile.
+	PendingWindow time.Duration
+
+	// StaleAfter is how long a credential may go without a successful
+	// refresh before the summary flags it.
+	StaleAfter time.Duration
+	// FailOnCredentialProblems makes the run exit non-zero when a credential
+	// is in error, needs re-authentication or is stale.
+	FailOnCredentialProblems bool
+
+	// SyncAttachments uploads receipts attached in Moneytree to the matching
+	// Pocketsmith transactions.
+	SyncAttachments bool
+
+	// PayeeWriteback copies payees edited in Pocketsmith back to Moneytree:
+	// "" (off), "dry-run" or "apply".
+	PayeeWriteback string
+
+	// ClosedAccountActions is what happens to the Pocketsmith account of a
+	// closed Moneytree account: "balance", "exclude" and/or "rename". Empty
+	// leaves it alone.
+	ClosedAccountActions map[string]bool
+
+	// AccountNameTemplate names Pocketsmith accounts. Nil uses the built-in
+	// "Institution - Name (Number)" naming.
+	AccountNameTemplate *accountname.Template
+
 	NumTransactions int
 }
 
@@ -55,10 +143,89 @@ func getConfig() *Config {
 	flag.StringVar(&config.MoneytreeUsername, "username", os.Getenv("MONEYTREE_USERNAME"), "Moneytree username")
 	flag.StringVar(&config.MoneytreePassword, "password", os.Getenv("MONEYTREE_PASSWORD"), "Moneytree password")
 	flag.StringVar(&config.MoneytreeApiKey, "apikey", os.Getenv("MONEYTREE_API_KEY"), "Moneytree API KEY")
+	flag.StringVar(&config.TokenCachePath, "token-cache", os.Getenv("MONEYTREE_TOKEN_CACHE"), "Path to a file to cache Moneytree tokens in between runs (optional)")
+
+	flag.StringVar(&config.MoneytreeAuthURL, "auth-url", os.Getenv("MONEYTREE_AUTH_URL"), "Moneytree OAuth server URL (default: the real Moneytree)")
+	flag.StringVar(&config.MoneytreeRegion, "region", os.Getenv("MONEYTREE_REGION"), "Moneytree API region, e.g. jp (default: the region your account lives in)")
+	flag.IntVar(&config.MaxRetries, "max-retries", envInt("MONEYTREE_MAX_RETRIES", moneytree.DefaultRetryPolicy.MaxRetries), "How often to retry failed Moneytree requests")
+
+	flag.DurationVar(&config.RefreshTimeout, "refresh-timeout", envDuration("MONEYTREE_REFRESH_TIMEOUT", 10*time.Minute), "How long to wait for Moneytree to refresh credentials")
+
+	var refreshInstitutions, refreshCredentials string
+	flag.StringVar(&refreshInstitutions, "refresh-institutions", os.Getenv("MONEYTREE_REFRESH_INSTITUTIONS"), "Comma-separated institution names to refresh (default: all)")
+	flag.StringVar(&refreshCredentials, "refresh-credentials", os.Getenv("MONEYTREE_REFRESH_CREDENTIALS"), "Comma-separated Moneytree credential IDs to refresh (default: all)")
+
+	flag.StringVar(&config.StateFile, "state-file", os.Getenv("SYNC_STATE_FILE"), "File to remember sync progress in, enables incremental sync (optional)")
+	flag.BoolVar(&config.FullSync, "full", false, "Ignore saved sync progress and re-scan all transactions")
+	flag.IntVar(&config.LookbackDays, "lookback-days", envInt("SYNC_LOOKBACK_DAYS", 7), "How many days before the last synced transaction an incremental sync starts")
+
+	flag.BoolVar(&config.SyncPositions, "sync-positions", os.Getenv("SYNC_POSITIONS") == "true", "Sync the holdings of stock accounts as separate Pocketsmith accounts")
+
+	var pointRates string
+	flag.BoolVar(&config.SyncPoints, "sync-points", os.Getenv("SYNC_POINTS") == "true", "Sync point-program accounts as other-asset accounts valued in your base currency")
+	flag.StringVar(&pointRates, "point-rates", os.Getenv("POINT_RATES"), "Comma-separated value of one point per program, e.g. ANA=1.5,*=1 (default 1)")
+
+	flag.StringVar(&config.CategoryMapPath, "category-map", os.Getenv("CATEGORY_MAP_FILE"), "JSON file mapping Moneytree categories to Pocketsmith categories (optional)")
+	flag.BoolVar(&config.CreateCategories, "create-categories", os.Getenv("CREATE_CATEGORIES") == "true", "Create missing Pocketsmith categories")
+
+	flag.StringVar(&config.ClassificationRulesPath, "classification-rules", os.Getenv("CLASSIFICATION_RULES_FILE"), "JSON file with keyword rules classifying transactions as income, expense or transfer (optional)")
+
+	flag.DurationVar(&config.PendingWindow, "pending-window", envDuration("PENDING_WINDOW", 14*24*time.Hour), "How long a pending card transaction may take to post before it is deleted from Pocketsmith")
+
+	flag.DurationVar(&config.StaleAfter, "stale-after", envDuration("CREDENTIAL_STALE_AFTER", 72*time.Hour), "Flag credentials without a successful refresh for this long (0 disables)")
+	flag.BoolVar(&config.FailOnCredentialProblems, "fail-on-credential-problems", os.Getenv("FAIL_ON_CREDENTIAL_PROBLEMS") == "true", "Exit with code 3 when a credential needs attention")
+
+	flag.BoolVar(&config.SyncAttachments, "sync-attachments", os.Getenv("SYNC_ATTACHMENTS") == "true", "Upload receipts attached in Moneytree to the Pocketsmith transactions")
+
+	flag.StringVar(&config.PayeeWriteback, "writeback-payees", os.Getenv("WRITEBACK_PAYEES"), "Copy payees edited in Pocketsmith back to Moneytree: dry-run or apply (default: off)")
+
+	var accountNameTemplate string
+	flag.StringVar(&accountNameTemplate, "account-name-template", os.Getenv("ACCOUNT_NAME_TEMPLATE"), "Go text/template for Pocketsmith account names, e.g. {{or .Nickname .Name}} {{.Number}} (optional)")
+
+	var closedActions string
+	flag.StringVar(&closedActions, "closed-accounts", os.Getenv("CLOSED_ACCOUNTS"), "What to do with accounts closed in Moneytree: comma-separated balance, exclude, rename or all (default: nothing)")
 
 	flag.StringVar(&config.PocketsmithToken, "pocketsmith-token", os.Getenv("POCKETSMITH_TOKEN"), "Pocketsmith API token")
 	flag.Parse()
 
+	config.RefreshInstitutions = splitList(refreshInstitutions)
+	for _, id := range splitList(refreshCredentials) {
+		credentialID, err := strconv.Atoi(id)
+		if err != nil {
+			fmt.Printf("Error: invalid credential ID %q in -refresh-credentials\n", id)
+			os.Exit(1)
+		}
+		config.RefreshCredentialIDs = append(config.RefreshCredentialIDs, credentialID)
+	}
+
+	rates, err := parsePointRates(pointRates)
+	if err != nil {
+		fmt.Printf("Error: %s in -point-rates\n", err)
+		os.Exit(1)
+	}
+	config.PointRates = rates
+
+	if accountNameTemplate != "" {
+		config.AccountNameTemplate, err = accountname.Parse(accountNameTemplate)
+		if err != nil {
+			fmt.Printf("Error: invalid -account-name-template: %s\n", err)
+			os.Exit(1)
+		}
+	}
+
+	config.ClosedAccountActions, err = parseClosedActions(closedActions)
+	if err != nil {
+		fmt.Printf("Error: %s in -closed-accounts\n", err)
+		os.Exit(1)
+	}
+
+	switch config.PayeeWriteback {
+	case payeeWritebackOff, payeeWritebackDryRun, payeeWritebackApply:
+	default:
+		fmt.Printf("Error: invalid -writeback-payees %q, use dry-run or apply\n", config.PayeeWriteback)
+		os.Exit(1)
+	}
+
 	// Validate required fields
 	if config.MoneytreeUsername == "" {
 		fmt.Println("Error: Moneytree username is required. Set via -username flag or MONEYTREE_USERNAME environment variable")
@@ -80,6 +247,56 @@ func getConfig() *Config {
 	return config
 }
 
+// envInt reads an integer environment variable, falling back to def when it's
+// unset or not a number.
+func envInt(name string, def int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+
+	return value
+}
+
+// splitList splits a comma-separated flag value, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// envDuration reads a duration environment variable like "10m", falling back
+// to def when it's unset or invalid.
+func envDuration(name string, def time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return def
+	}
+
+	return value
+}
+
+// interrupted reports whether err happened because the sync was asked to stop
+// (Ctrl-C / SIGTERM), which is a clean exit rather than a failure.
+func interrupted(ctx context.Context, err error) bool {
+	return err != nil && (errors.Is(err, context.Canceled) || ctx.Err() != nil)
+}
+
+// loginMoneytree logs in to Moneytree and returns the guest with its
+// credentials.
+func loginMoneytree(ctx context.Context, mt *moneytree.Moneytree, config *Config) (*moneytree.MTGuest, error) {
+	if err := mt.LoginContext(ctx, config.MoneytreeUsername, config.MoneytreePassword); err != nil {
+		return nil, err
+	}
+
+	return mt.GetGuestMetaContext(ctx)
+}
+
 func findCredentialFromMeta(gm *moneytree.MTGuest, credentialID int) *moneytree.MTCredential {
 	for _, credential := range gm.Credentials {
 		if credential.ID == credentialID {
@@ -90,27 +307,34 @@ func findCredentialFromMeta(gm *moneytree.MTGuest, credentialID int) *moneytree.
 	return nil
 }
 
-func findOrCreateAccount(ps *pocketsmith.Client, userID int, institutionName string, baseName string, accountType moneytree.MTAccountType, currency string) (*pocketsmith.Account, error) {
-	displayName := accountmatch.BuildDisplayAccountName(institutionName, baseName)
+func findOrCreateAccount(ps *pocketsmith.Client, userID int, state *syncstate.State, name accountName, accountType moneytree.MTAccountType, currency string) (*pocketsmith.Account, error) {
+	displayName := name.display
 
 	accounts, err := ps.ListAccounts(userID)
 	if err != nil {
 		return nil, err
 	}
 
-	account, err := accountmatch.FindMatchingAccount(accounts, institutionName, baseName, displayName)
+	account, linked, err := lookupAccount(accounts, state, name)
 	if err != nil {
 		if err != pocketsmith.ErrNotFound {
 			return nil, err
 		}
 
-		institution, err := ps.FindInstitutionByName(userID, institutionName)
+		// accounts without an institution, like cash wallets, still need one
+		// in Pocketsmith
+		psInstitutionName := name.institution
+		if strings.TrimSpace(psInstitutionName) == "" {
+			psInstitutionName = cashInstitutionName
+		}
+
+		institution, err := ps.FindInstitutionByName(userID, psInstitutionName)
 		if err != nil {
 			if err != pocketsmith.ErrNotFound {
 				return nil, err
 			}
 
-			institution, err = ps.CreateInstitution(userID, institutionName, strings.ToLower(currency))
+			institution, err = ps.CreateInstitution(userID, psInstitutionName, strings.ToLower(currency))
 			if err != nil {
 				return nil, err
 			}
@@ -128,6 +352,8 @@ func findOrCreateAccount(ps *pocketsmith.Client, userID int, institutionName str
 			psAccountType = pocketsmith.AccountTypeStocks
 		case moneytree.MTAccountTypePoint:
 			psAccountType = pocketsmith.AccountTypeOtherAsset
+		case moneytree.MTAccountTypeCash:
+			psAccountType = pocketsmith.AccountTypeCash
 		default:
 			psAccountType = pocketsmith.AccountTypeOtherAsset
 		}
@@ -138,17 +364,38 @@ func findOrCreateAccount(ps *pocketsmith.Client, userID int, institutionName str
 			return nil, err
 		}
 
+		linkAccount(state, name, account)
 		return account, nil
 	}
+	linkAccount(state, name, account)
 
-	if account.Title != displayName {
-		fmt.Printf("Renaming Pocketsmith account: %q -> %q\n", account.Title, displayName)
-		updated, err := ps.UpdateAccount(account.ID, displayName, account.CurrencyCode, account.Type, account.IsNetWorth)
+	title, isNetWorth := syncedTitle(state, name, account, linked), account.IsNetWorth
+	// an account the sync closed that is in use again was reopened
+	reopenedIsNetWorth, reopened := reopenedNetWorth(state, name, account)
+	if reopened {
+		isNetWorth = reopenedIsNetWorth
+	}
+
+	if title != account.Title || isNetWorth != account.IsNetWorth {
+		fmt.Printf("Updating Pocketsmith account %q: title %q, net worth %t\n", account.Title, title, isNetWorth)
+		updated, err := ps.UpdateAccount(account.ID, title, account.CurrencyCode, account.Type, isNetWorth)
 		if err != nil {
 			sentry.CaptureException(err)
-			fmt.Println("Error renaming account: ", err)
-		} else {
-			account = updated
+			fmt.Println("Error updating account: ", err)
+			return account, nil
+		}
+		account = updated
+	}
+
+	if state != nil {
+		if reopened {
+			state.Reopen(name.moneytreeID)
+		}
+		if recordLinkTitle(state, name, account) || reopened {
+			if err := state.Save(); err != nil {
+				sentry.CaptureException(err)
+				fmt.Println("Error saving sync state: ", err)
+			}
 		}
 	}
 
@@ -156,8 +403,20 @@ func findOrCreateAccount(ps *pocketsmith.Client, userID int, institutionName str
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "link", "unlink", "links":
+			os.Exit(runLinkCommand(os.Args[1], os.Args[2:]))
+		}
+	}
+
 	config := getConfig()
 
+	// cancelled on Ctrl-C / SIGTERM so in-flight Moneytree requests and the
+	// refresh wait stop instead of running to completion
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	ps := pocketsmith.NewClient(config.PocketsmithToken)
 	currentUserRes, err := ps.GetCurrentUser()
 	if err != nil {
@@ -165,79 +424,169 @@ func main() {
 		panic(err)
 	}
 
-	mt := moneytree.NewClient(config.MoneytreeApiKey)
-	_, err = mt.GetAccessToken(config.MoneytreeUsername, config.MoneytreePassword)
-	if err != nil {
-		sentry.CaptureException(err)
-		panic(err)
+	retryPolicy := moneytree.DefaultRetryPolicy
+	retryPolicy.MaxRetries = config.MaxRetries
+	mtOpts := []moneytree.Option{moneytree.WithRetryPolicy(retryPolicy)}
+	if config.MoneytreeAuthURL != "" {
+		mtOpts = append(mtOpts, moneytree.WithAuthURL(config.MoneytreeAuthURL))
+	}
+	if config.MoneytreeRegion != "" {
+		mtOpts = append(mtOpts, moneytree.WithRegion(config.MoneytreeRegion))
 	}
+	if config.TokenCachePath != "" {
+		mtOpts = append(mtOpts, moneytree.WithTokenStore(moneytree.NewFileTokenStore(config.TokenCachePath)))
+	}
+
+	mt := moneytree.NewClient(config.MoneytreeApiKey, mtOpts...)
 
-	guestMeta, err := mt.GetGuestMeta()
+	guestMeta, err := loginMoneytree(ctx, mt, config)
+	if interrupted(ctx, err) {
+		fmt.Println("Interrupted while logging in to Moneytree, exiting")
+		return
+	}
 	if err != nil {
 		sentry.CaptureException(err)
 		panic(err)
 	}
 
-	mt.RefreshAllCredentials()
-	// wait 5 min for the refresh to kick-in and pull the newest transactions
-	fmt.Println("Refreshing Moneytree and waiting 5 min for transactions to update...")
-	time.Sleep(5 * time.Minute)
+	if !refreshCredentials(ctx, mt, guestMeta, config) {
+		fmt.Println("Interrupted while waiting for the refresh, exiting")
+		return
+	}
 
-	accounts, err := mt.GetAccounts()
+	accounts, err := mt.GetAccountsContext(ctx)
+	if interrupted(ctx, err) {
+		fmt.Println("Interrupted while getting accounts, exiting")
+		return
+	}
 	if err != nil {
 		sentry.CaptureException(err)
 		panic(err)
 	}
 
+	psx := pocketsmithx.NewClient(config.PocketsmithToken)
+
+	baseCurrency := guestMeta.BaseCurrency
+	if baseCurrency == "" {
+		baseCurrency = "JPY"
+	}
+
+	var categories *categorymap.Mapper
+	if config.CategoryMapPath != "" || config.CreateCategories {
+		categories, err = newCategoryMapper(ctx, mt, psx, currentUserRes.ID, config)
+		if err != nil {
+			sentry.CaptureException(err)
+			fmt.Println("Error setting up category mapping, transactions will be uncategorised: ", err)
+		}
+	}
+
+	var rules *classify.File
+	if config.ClassificationRulesPath != "" {
+		rules, err = classify.LoadFile(config.ClassificationRulesPath)
+		if err != nil {
+			sentry.CaptureException(err)
+			panic(err)
+		}
+	}
+	classifier := classify.New(rules)
+
+	var state *syncstate.State
+	if config.StateFile != "" {
+		state, err = syncstate.Load(config.StateFile)
+		if err != nil {
+			sentry.CaptureException(err)
+			panic(err)
+		}
+	}
+
 	for _, account := range accounts {
-		if account.Status == "closed" {
-			continue
+		if ctx.Err() != nil {
+			fmt.Println("Interrupted, stopping sync")
+			break
 		}
 
-		// not supported by pocketsmith
-		if account.AccountType == moneytree.MTAccountTypeCash || account.AccountType == moneytree.MTAccountTypePoint {
+		if account.Status == "closed" && len(config.ClosedAccountActions) == 0 {
 			continue
 		}
 
-		credential := findCredentialFromMeta(guestMeta, account.CredentialID)
-		if credential == nil {
-			fmt.Println("Credential not found for account: ", account.InstitutionAccountName)
+		// cash wallets are kept by hand in Moneytree and have no institution
+		institutionName := ""
+		if account.AccountType != moneytree.MTAccountTypeCash {
+			credential := findCredentialFromMeta(guestMeta, account.CredentialID)
+			if credential == nil {
+				fmt.Println("Credential not found for account: ", account.InstitutionAccountName)
+				continue
+			}
+			institutionName = credential.InstitutionName
+		}
+
+		fmt.Println("Processing moneytree account: ", account.ID, institutionName, account.InstitutionAccountName, account.InstitutionAccountNumber)
+
+		psName, err := newAccountName(account, institutionName, config.AccountNameTemplate)
+		if err != nil {
+			sentry.CaptureException(err)
+			fmt.Println("Error naming account, skipping it: ", err)
 			continue
 		}
 
-		fmt.Println("Processing moneytree account: ", credential.InstitutionName, account.InstitutionAccountName, account.InstitutionAccountNumber)
+		if account.Status == "closed" {
+			finalBalance := account.CurrentBalance
+			if account.AccountType == moneytree.MTAccountTypePoint {
+				finalBalance *= pointRateFor(config.PointRates, institutionName, account)
+			}
+			closeAccount(ps, currentUserRes.ID, state, psName, finalBalance, config.ClosedAccountActions)
+			continue
+		}
 
-		baseName := fmt.Sprintf("%s (%s)", account.InstitutionAccountName, account.InstitutionAccountNumber)
-		if account.Currency != "JPY" {
-			if !strings.Contains(baseName, account.Currency) || !strings.Contains(baseName, account.Currency[0:2]) {
-				baseName = fmt.Sprintf("%s (%s) (%s)", account.InstitutionAccountName, account.Currency, account.InstitutionAccountNumber)
+		// points only have a balance, valued in the base currency
+		if account.AccountType == moneytree.MTAccountTypePoint {
+			if config.SyncPoints {
+				syncPointAccount(ps, currentUserRes.ID, state, psName, baseCurrency, account, config.PointRates)
 			}
+			continue
 		}
 
-		psAccount, err := findOrCreateAccount(ps, currentUserRes.ID, credential.InstitutionName, baseName, account.AccountType, account.Currency)
+		psAccount, err := findOrCreateAccount(ps, currentUserRes.ID, state, psName, account.AccountType, account.Currency)
+		if interrupted(ctx, err) {
+			fmt.Println("Interrupted, stopping sync")
+			break
+		}
 		if err != nil {
 			fmt.Println("Error creating account: ", err)
 			sentry.CaptureException(err)
 			panic(err)
 		}
 
-		page := 1
-		var mergedTxs []*moneytree.MTTransaction
-		for {
-			txs, err := mt.GetTransactions(account.ID, "2010-01-01", page, 500)
-			if err != nil {
-				fmt.Println("Error getting transactions: ", err)
-				sentry.CaptureException(err)
-				panic(err)
+		since := "2010-01-01"
+		if state != nil && !config.FullSync {
+			if incrementalSince, ok := state.Account(account.ID).Since(time.Duration(config.LookbackDays) * 24 * time.Hour); ok {
+				since = incrementalSince
 			}
+		}
+		fmt.Println("Fetching transactions since: ", since)
 
-			if len(txs) == 0 {
+		// everything is collected first instead of synced page by page: the
+		// duplicate detection below stops after a run of already synced
+		// transactions and relies on going through them newest first. A pending transaction and the
+		// one it posted as can also be on different pages, and the
+		// high-water mark is only advanced once the whole list made it.
+		var mergedTxs []*moneytree.MTTransaction
+		var txErr error
+		for tx, err := range mt.Transactions(ctx, account.ID, since) {
+			if err != nil {
+				txErr = err
 				break
 			}
 
-			mergedTxs = append(mergedTxs, txs...)
+			mergedTxs = append(mergedTxs, tx)
+		}
 
-			page++
+		// the client already retried, so give up on this account but keep
+		// going with the others
+		if txErr != nil {
+			fmt.Println("Error getting transactions, skipping account: ", txErr)
+			sentry.CaptureException(txErr)
+			continue
 		}
 
 		fmt.Println("num merged txs: ", len(mergedTxs))
@@ -246,9 +595,21 @@ func main() {
 			return mergedTxs[i].Date.After(mergedTxs[j].Date)
 		})
 
+		// a pending card transaction and its posted replacement can both be
+		// listed, only the posted one should end up in Pocketsmith
+		mergedTxs = dropSupersededClaims(mergedTxs)
+
 		repeatedFoundTransactions := 0
+		// only advance the high-water mark when every transaction made it
+		// into Pocketsmith, otherwise the next run would skip the failed ones
+		txFailed := false
 		for i, tx := range mergedTxs {
-			if repeatedFoundTransactions > 15 {
+			if ctx.Err() != nil {
+				break
+			}
+
+			// a full re-scan is explicitly asked to look at everything
+			if repeatedFoundTransactions > 15 && !config.FullSync {
 				fmt.Println("Too many repeated transactions found, likely everything processed already. Skipping...")
 				break
 			}
@@ -263,47 +624,101 @@ func main() {
 			}
 
 			name = strings.TrimSpace(name)
-			convertedPayee := sanitizier.Sanitize(name)
+			convertedPayee := payeeFromName(name)
 
-			if convertedPayee == "" {
-				convertedPayee = "Unknown"
-			}
+			decision := classifier.Classify(tx)
 
-			fmt.Printf("[%d/%d] Processing moneytree transaction: %d %s %s\n", i+1, len(mergedTxs), tx.ID, convertedPayee, tx.Date.Format("2006-01-02"))
+			fmt.Printf("[%d/%d] Processing moneytree transaction: %d %s %s (%s)\n", i+1, len(mergedTxs), tx.ID, convertedPayee, tx.Date.Format("2006-01-02"), decision.Kind)
 
 			// Convert to pocketsmith transaction
 			mtidMemo := fmt.Sprintf("mtid=%d", tx.RawTransactionID)
+			memo := fmt.Sprintf("%s %s", name, mtidMemo)
+			if tx.ClaimID != 0 {
+				memo += " " + claimMarker(tx.ClaimID)
+			}
 			psTx := &pocketsmith.Transaction{
 				Payee:       convertedPayee,
 				Amount:      tx.Amount,
 				Date:        tx.Date.Format("2006-01-02"),
-				IsTransfer:  strings.Contains(name, "振込"),
+				IsTransfer:  decision.Kind == classify.Transfer,
 				NeedsReview: false,
 				// Note:         fmt.Sprintf("%s %d", strings.TrimSpace(tx.DescriptionPretty), tx.ID),
-				Memo:         fmt.Sprintf("%s %s", name, mtidMemo),
+				Memo:         fmt.Sprintf("%s %s", memo, decision.Memo()),
 				ChequeNumber: fmt.Sprintf("%d", tx.RawTransactionID),
 			}
 
+			if categories != nil && tx.CategoryID != 0 {
+				categoryID, err := categories.CategoryID(tx.CategoryID)
+				if err != nil {
+					sentry.CaptureException(err)
+					fmt.Println("Error mapping category: ", err)
+				} else if categoryID != 0 {
+					psTx.CategoryID = pocketsmith.CategoryID(categoryID)
+				}
+			}
+
 			searchResByChequeNumber, err := ps.SearchTransactionsByMemoContains(psAccount.PrimaryTransactionAccount.ID, tx.Date, mtidMemo)
 			if err != nil {
 				sentry.CaptureException(err)
 				fmt.Println("Error searching transactions by cheque number: ", err)
+				txFailed = true
 				continue
 			}
+			searchResByChequeNumber = withMemoField(searchResByChequeNumber, mtidMemo)
 
 			if len(searchResByChequeNumber) > 0 {
 				fmt.Println("Found transaction by cheque number: ", name)
+				if config.SyncAttachments {
+					if err := transferAttachments(ctx, ps, mt, currentUserRes.ID, state, tx, searchResByChequeNumber[0].ID); err != nil {
+						sentry.CaptureException(err)
+						fmt.Println("Error transferring attachments: ", err)
+					}
+				}
 				repeatedFoundTransactions++
 				continue
 			} else {
 				repeatedFoundTransactions = 0
 			}
 
+			// a card transaction that posted replaces the one pushed while it
+			// was pending instead of being added next to it
+			if tx.ClaimID != 0 {
+				pending, err := findClaimTransaction(ps, psAccount.PrimaryTransactionAccount.ID, tx, config.PendingWindow)
+				if err != nil {
+					sentry.CaptureException(err)
+					fmt.Println("Error searching pending transactions: ", err)
+					txFailed = true
+					continue
+				}
+
+				if pending != nil {
+					fmt.Println("Pending transaction posted, updating it in place: ", name)
+					if _, err := ps.UpdateTransaction(pending.ID, psTx); err != nil {
+						sentry.CaptureException(err)
+						fmt.Println("Error updating pending transaction: ", err)
+						txFailed = true
+						continue
+					}
+
+					if state != nil {
+						state.ResolveClaim(tx.ClaimID)
+					}
+					if config.SyncAttachments {
+						if err := transferAttachments(ctx, ps, mt, currentUserRes.ID, state, tx, pending.ID); err != nil {
+							sentry.CaptureException(err)
+							fmt.Println("Error transferring attachments: ", err)
+						}
+					}
+					continue
+				}
+			}
+
 			// try to find the transaction first
 			searchRes, err := ps.SearchTransactions(psAccount.PrimaryTransactionAccount.ID, tx.Date.Format("2006-01-02"), tx.Date.Format("2006-01-02"), fmt.Sprintf("%d", tx.ID))
 			if err != nil {
 				sentry.CaptureException(err)
 				fmt.Println("Error searching transactions: ", err)
+				txFailed = true
 				continue
 			}
 
@@ -321,6 +736,7 @@ func main() {
 						if err != nil {
 							sentry.CaptureException(err)
 							fmt.Println("Error updating", err)
+							txFailed = true
 							continue
 						}
 
@@ -342,11 +758,79 @@ func main() {
 			if err != nil {
 				sentry.CaptureException(err)
 				fmt.Println("Error adding transaction: ", err)
+				txFailed = true
 				continue
 			}
+
+			trackClaim := state != nil && tx.ClaimID != 0
+			if trackClaim || (config.SyncAttachments && len(tx.TransactionAttachments) > 0) {
+				// AddTransaction doesn't return the ID, look the transaction up again
+				added, err := ps.SearchTransactionsByMemoContains(psAccount.PrimaryTransactionAccount.ID, tx.Date, mtidMemo)
+				if err == nil {
+					if added = withMemoField(added, mtidMemo); len(added) != 1 {
+						err = fmt.Errorf("found %d transactions with %s after adding it, expected 1", len(added), mtidMemo)
+					}
+				}
+				if err != nil {
+					sentry.CaptureException(err)
+					fmt.Println("Error finding added transaction: ", err)
+					continue
+				}
+
+				if trackClaim {
+					claim := syncstate.PendingClaim{
+						AccountID:        account.ID,
+						RawTransactionID: tx.RawTransactionID,
+						PocketsmithID:    added[0].ID,
+						Date:             tx.Date.Format("2006-01-02"),
+					}
+					if existing, ok := state.TrackClaim(tx.ClaimID, claim); !ok {
+						msg := fmt.Sprintf("claim %d already tracks Pocketsmith transaction %d, not tracking %d as well; check for a duplicate", tx.ClaimID, existing.PocketsmithID, claim.PocketsmithID)
+						sentry.CaptureMessage(msg)
+						fmt.Println("Warning: ", msg)
+					}
+				}
+
+				if config.SyncAttachments {
+					if err := transferAttachments(ctx, ps, mt, currentUserRes.ID, state, tx, added[0].ID); err != nil {
+						sentry.CaptureException(err)
+						fmt.Println("Error transferring attachments: ", err)
+					}
+				}
+			}
+		}
+
+		// don't touch the balance when the transactions are only half synced
+		if ctx.Err() != nil {
+			fmt.Println("Interrupted, stopping sync")
+			break
+		}
+
+		if state != nil && !txFailed {
+			expirePendingClaims(ctx, mt, psx, state, account.ID, config.PendingWindow)
+
+			accountState := state.Account(account.ID)
+			for _, tx := range mergedTxs {
+				accountState.Advance(tx.Date, tx.UpdatedAt)
+			}
+
+			if err := state.Save(); err != nil {
+				sentry.CaptureException(err)
+				fmt.Println("Error saving sync state: ", err)
+			}
+		}
+
+		// edits to older transactions are never seen by the loop above, so
+		// the whole account is checked separately
+		if config.PayeeWriteback != payeeWritebackOff {
+			writeBackPayees(ctx, ps, mt, config.PayeeWriteback, state, account.ID, psAccount.PrimaryTransactionAccount.ID)
+		}
+
+		if config.SyncPositions && account.AccountType == moneytree.MTAccountTypeStock {
+			syncPositions(ctx, ps, mt, currentUserRes.ID, state, account, psName)
 		}
 
-		psAccount, err = findOrCreateAccount(ps, currentUserRes.ID, credential.InstitutionName, baseName, account.AccountType, account.Currency)
+		psAccount, err = findOrCreateAccount(ps, currentUserRes.ID, state, psName, account.AccountType, account.Currency)
 		if err != nil {
 			sentry.CaptureException(err)
 			fmt.Println("Error creating account: ", err)
@@ -378,4 +862,13 @@ func main() {
 			fmt.Println("balance diverted, MT balance is smaller than on PS, manually setting a new start-balance: ", updateRes.CurrentBalance)
 		}
 	}
+
+	if ctx.Err() != nil {
+		return
+	}
+
+	problems := reportCredentialHealth(ctx, mt, guestMeta, config)
+	if code := credentialExitCode(problems, config); code != 0 {
+		os.Exit(code)
+	}
 }
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+)
+
+func TestLoginStopsCleanlyWhenCancelled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token":"token","expires_in":7200}`))
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	mt := moneytree.NewClient("key", moneytree.WithAuthURL(srv.URL), moneytree.WithBaseURL(srv.URL))
+	guest, err := loginMoneytree(ctx, mt, &Config{MoneytreeUsername: "guest", MoneytreePassword: "secret"})
+	if guest != nil || err == nil {
+		t.Fatalf("loginMoneytree() = %+v, %v, want an error", guest, err)
+	}
+	if !interrupted(ctx, err) {
+		t.Errorf("interrupted(%v) = false, want true so the sync exits instead of panicking", err)
+	}
+
+	if interrupted(context.Background(), errors.New("invalid_grant")) {
+		t.Error("interrupted() of a login failure = true, want false")
+	}
+}
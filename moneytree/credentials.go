@@ -0,0 +1,155 @@
+package moneytree
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// MTCredentialErrorInfo describes why the last refresh of a credential
+// failed. Moneytree sends either an object or a plain message string; both
+// are accepted, and the original JSON is kept in Raw.
+type MTCredentialErrorInfo struct {
+	Code    string
+	Title   string
+	Message string
+	Raw     json.RawMessage
+}
+
+func (e *MTCredentialErrorInfo) UnmarshalJSON(data []byte) error {
+	e.Raw = append(json.RawMessage(nil), data...)
+
+	var message string
+	if err := json.Unmarshal(data, &message); err == nil {
+		e.Message = message
+		return nil
+	}
+
+	var fields struct {
+		Code         string `json:"code"`
+		ErrorCode    string `json:"error_code"`
+		Title        string `json:"title"`
+		ErrorTitle   string `json:"error_title"`
+		Message      string `json:"message"`
+		ErrorMessage string `json:"error_message"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	e.Code = firstNonEmpty(fields.Code, fields.ErrorCode)
+	e.Title = firstNonEmpty(fields.Title, fields.ErrorTitle)
+	e.Message = firstNonEmpty(fields.Message, fields.ErrorMessage)
+
+	return nil
+}
+
+func (e *MTCredentialErrorInfo) MarshalJSON() ([]byte, error) {
+	if len(e.Raw) > 0 {
+		return e.Raw, nil
+	}
+
+	return json.Marshal(map[string]string{"code": e.Code, "title": e.Title, "message": e.Message})
+}
+
+// String returns the most descriptive part of the error.
+func (e *MTCredentialErrorInfo) String() string {
+	switch {
+	case e.Message != "":
+		return e.Message
+	case e.Title != "":
+		return e.Title
+	default:
+		return e.Code
+	}
+}
+
+// IsEmpty reports whether the error info carries no information at all,
+// which Moneytree sends as {} for healthy credentials.
+func (e *MTCredentialErrorInfo) IsEmpty() bool {
+	return e == nil || (e.Code == "" && e.Title == "" && e.Message == "")
+}
+
+// MTAdditionalStatusInformation is extra context on a credential status, for
+// example which action the guest has to take in the app.
+type MTAdditionalStatusInformation struct {
+	Type    string
+	Message string
+	Raw     json.RawMessage
+}
+
+func (a *MTAdditionalStatusInformation) UnmarshalJSON(data []byte) error {
+	a.Raw = append(json.RawMessage(nil), data...)
+
+	var message string
+	if err := json.Unmarshal(data, &message); err == nil {
+		a.Message = message
+		return nil
+	}
+
+	var fields struct {
+		Type    string `json:"type"`
+		Status  string `json:"status"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+
+	a.Type = firstNonEmpty(fields.Type, fields.Status)
+	a.Message = fields.Message
+
+	return nil
+}
+
+func (a *MTAdditionalStatusInformation) MarshalJSON() ([]byte, error) {
+	if len(a.Raw) > 0 {
+		return a.Raw, nil
+	}
+
+	return json.Marshal(map[string]string{"type": a.Type, "message": a.Message})
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
+
+// Credential statuses that only the guest can resolve by logging in to the
+// bank again through the Moneytree app.
+var reauthStatuses = map[string]bool{
+	"auth_failed":                 true,
+	"guest_intervention_required": true,
+	"bad_credentials":             true,
+	"password_expired":            true,
+}
+
+// NeedsReauth reports whether the credential needs the guest to
+// re-authenticate before Moneytree can fetch new data.
+func (c *MTCredential) NeedsReauth() bool {
+	return reauthStatuses[c.Status]
+}
+
+// InError reports whether the last refresh of the credential failed.
+func (c *MTCredential) InError() bool {
+	if c.Status == CredentialStatusSuccess || refreshingStatuses[c.Status] {
+		return !c.ErrorInfo.IsEmpty()
+	}
+
+	return true
+}
+
+// IsStale reports whether the credential hasn't refreshed successfully for
+// longer than maxAge. Credentials that never succeeded are stale.
+func (c *MTCredential) IsStale(now time.Time, maxAge time.Duration) bool {
+	lastSuccess, err := parseTimestamp(c.LastSuccess)
+	if err != nil {
+		return true
+	}
+
+	return now.Sub(lastSuccess) > maxAge
+}
@@ -0,0 +1,40 @@
+package moneytree
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCredentialDecodingAndHealth(t *testing.T) {
+	data := `{"guest":{"credentials":[
+		{"id":1,"status":"success","error_info":{},"additional_status_information":null,"last_success":"2025-01-10T00:00:00Z"},
+		{"id":2,"status":"auth_failed","error_info":{"error_code":"E01","error_message":"Password changed"},"last_success":"2025-01-01T00:00:00Z"},
+		{"id":3,"status":"fetch_failed","error_info":"Bank under maintenance","additional_status_information":{"type":"maintenance","message":"Try again later"}}
+	]}}`
+
+	var res GetGuestResponse
+	if err := json.Unmarshal([]byte(data), &res); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	creds := res.Guest.Credentials
+	now := time.Date(2025, 1, 11, 0, 0, 0, 0, time.UTC)
+
+	if creds[0].InError() || creds[0].NeedsReauth() || creds[0].IsStale(now, 72*time.Hour) {
+		t.Errorf("credential 1 should be healthy: %+v", creds[0])
+	}
+
+	if !creds[1].NeedsReauth() || creds[1].ErrorInfo.Code != "E01" || creds[1].ErrorInfo.String() != "Password changed" {
+		t.Errorf("credential 2 = %+v, error info %+v", creds[1], creds[1].ErrorInfo)
+	}
+	if !creds[1].IsStale(now, 72*time.Hour) {
+		t.Error("credential 2 should be stale")
+	}
+
+	if !creds[2].InError() || creds[2].ErrorInfo.String() != "Bank under maintenance" || creds[2].AdditionalStatusInformation.Type != "maintenance" {
+		t.Errorf("credential 3 = %+v", creds[2])
+	}
+	if !creds[2].IsStale(now, 72*time.Hour) {
+		t.Error("credential 3 never succeeded and should be stale")
+	}
+}
@@ -0,0 +1,88 @@
+package moneytree
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// APIError is returned for any non-2xx response from Moneytree. Use errors.As
+// to get at it, then IsAuth, IsRateLimited or IsServerError to decide how to
+// react.
+type APIError struct {
+	StatusCode int
+	Method     string
+	// Endpoint is the path of the request that failed, without query string.
+	Endpoint string
+	// Code and Description come from Moneytree's error body
+	// ({"error": ..., "error_description": ...}) when there is one.
+	Code        string
+	Description string
+	RequestID   string
+	// RetryAfter is the delay the server asked for via Retry-After, if any.
+	RetryAfter time.Duration
+	// Body is the raw response body, kept for errors that don't follow the
+	// usual shape.
+	Body []byte
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("moneytree: %s %s returned %d", e.Method, e.Endpoint, e.StatusCode)
+	if e.Code != "" {
+		msg += ": " + e.Code
+	}
+	if e.Description != "" {
+		msg += " (" + e.Description + ")"
+	}
+	if e.RequestID != "" {
+		msg += " [request id " + e.RequestID + "]"
+	}
+
+	return msg
+}
+
+// IsAuth reports whether the request was rejected because of missing, expired
+// or invalid credentials.
+func (e *APIError) IsAuth() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden || e.Code == "invalid_grant"
+}
+
+func (e *APIError) IsRateLimited() bool {
+	return e.StatusCode == http.StatusTooManyRequests
+}
+
+func (e *APIError) IsServerError() bool {
+	return e.StatusCode >= 500
+}
+
+// IsAuthError reports whether err is an *APIError caused by authentication.
+func IsAuthError(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.IsAuth()
+}
+
+// newAPIError builds the error for a non-2xx response to req. req is passed
+// in because resp.Request isn't set by every RoundTripper.
+func newAPIError(req *http.Request, resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Method:     req.Method,
+		Endpoint:   req.URL.Path,
+		RequestID:  resp.Header.Get("X-Request-Id"),
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+		Body:       body,
+	}
+
+	var errBody struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &errBody); err == nil {
+		apiErr.Code = errBody.Error
+		apiErr.Description = errBody.ErrorDescription
+	}
+
+	return apiErr
+}
@@ -0,0 +1,82 @@
+package moneytree
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMakeRequestReturnsAPIError(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		wantAuth    bool
+		wantLimited bool
+		wantServer  bool
+		wantCode    string
+	}{
+		{"unauthorized", http.StatusUnauthorized, `{"error":"invalid_token","error_description":"The access token expired"}`, true, false, false, "invalid_token"},
+		{"invalid grant", http.StatusBadRequest, `{"error":"invalid_grant"}`, true, false, false, "invalid_grant"},
+		{"rate limited", http.StatusTooManyRequests, ``, false, true, false, ""},
+		{"server error", http.StatusBadGateway, `<html>bad gateway</html>`, false, false, true, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Request-Id", "req-123")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+			defer srv.Close()
+
+			_, err := NewClient("key").makeRequest(context.Background(), "GET", srv.URL+"/v8/api/accounts.json?page=1", nil, nil)
+
+			var apiErr *APIError
+			if !errors.As(err, &apiErr) {
+				t.Fatalf("makeRequest() error = %v, want *APIError", err)
+			}
+			if apiErr.StatusCode != tt.status || apiErr.Endpoint != "/v8/api/accounts.json" || apiErr.RequestID != "req-123" || apiErr.Code != tt.wantCode {
+				t.Errorf("APIError = %+v", apiErr)
+			}
+			if apiErr.IsAuth() != tt.wantAuth || apiErr.IsRateLimited() != tt.wantLimited || apiErr.IsServerError() != tt.wantServer {
+				t.Errorf("IsAuth/IsRateLimited/IsServerError = %v/%v/%v, want %v/%v/%v",
+					apiErr.IsAuth(), apiErr.IsRateLimited(), apiErr.IsServerError(), tt.wantAuth, tt.wantLimited, tt.wantServer)
+			}
+		})
+	}
+}
+
+// roundTripFunc is a RoundTripper that, unlike http.Transport, leaves
+// Response.Request unset.
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestAPIErrorFromCustomTransport(t *testing.T) {
+	transport := roundTripFunc(func(*http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusInternalServerError,
+			Header:     http.Header{},
+			Body:       io.NopCloser(strings.NewReader("")),
+		}, nil
+	})
+
+	mt := NewClient("key", WithHTTPClient(&http.Client{Transport: transport}))
+	_, err := mt.makeRequest(context.Background(), "GET", "https://example.com/v8/api/accounts.json", nil, nil)
+
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("makeRequest() error = %v, want *APIError", err)
+	}
+	if apiErr.Method != "GET" || apiErr.Endpoint != "/v8/api/accounts.json" || !apiErr.IsServerError() {
+		t.Errorf("APIError = %+v", apiErr)
+	}
+}
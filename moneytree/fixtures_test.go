@@ -0,0 +1,185 @@
+package moneytree
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/dvcrn/pocketsmith-anapay/moneytree/httpfixture"
+)
+
+// Run `go test ./moneytree -run TestFixtures -record` with MONEYTREE_USERNAME,
+// MONEYTREE_PASSWORD and MONEYTREE_API_KEY set to re-record the fixtures
+// against the live API.
+var record = flag.Bool("record", false, "record moneytree fixtures against the live API")
+
+const (
+	fixtureDir   = "testdata/fixtures"
+	fixtureSince = "2024-01-01"
+)
+
+// fixtureResponses are the decoded responses of every read-only endpoint the
+// sync uses.
+type fixtureResponses struct {
+	accounts     []MTAccount
+	transactions []*MTTransaction
+	positions    []MTPosition
+	categories   []MTCategory
+	guest        *MTGuest
+}
+
+func fetchFixtureResponses(t *testing.T, mt *Moneytree) fixtureResponses {
+	t.Helper()
+	ctx := context.Background()
+
+	var res fixtureResponses
+	var err error
+
+	if res.accounts, err = mt.GetAccountsContext(ctx); err != nil {
+		t.Fatalf("GetAccounts: %v", err)
+	}
+	if len(res.accounts) == 0 {
+		t.Fatal("GetAccounts returned no accounts")
+	}
+
+	for tx, err := range mt.Transactions(ctx, res.accounts[0].ID, fixtureSince) {
+		if err != nil {
+			t.Fatalf("Transactions: %v", err)
+		}
+		res.transactions = append(res.transactions, tx)
+	}
+
+	for _, account := range res.accounts {
+		if account.AccountType != MTAccountTypeStock {
+			continue
+		}
+		if res.positions, err = mt.GetPositionsContext(ctx, strconv.Itoa(account.ID)); err != nil {
+			t.Fatalf("GetPositions: %v", err)
+		}
+		break
+	}
+
+	if res.categories, err = mt.GetCategoriesContext(ctx); err != nil {
+		t.Fatalf("GetCategories: %v", err)
+	}
+	if res.guest, err = mt.GetGuestMetaContext(ctx); err != nil {
+		t.Fatalf("GetGuestMeta: %v", err)
+	}
+
+	return res
+}
+
+func TestFixturesRecord(t *testing.T) {
+	if !*record {
+		t.Skip("pass -record to re-record fixtures")
+	}
+
+	username, password, apiKey := os.Getenv("MONEYTREE_USERNAME"), os.Getenv("MONEYTREE_PASSWORD"), os.Getenv("MONEYTREE_API_KEY")
+	if username == "" || password == "" || apiKey == "" {
+		t.Fatal("MONEYTREE_USERNAME, MONEYTREE_PASSWORD and MONEYTREE_API_KEY must be set to record")
+	}
+
+	// drop old fixtures so files for accounts that no longer exist don't linger
+	old, _ := filepath.Glob(filepath.Join(fixtureDir, "*.json"))
+	for _, path := range old {
+		os.Remove(path)
+	}
+
+	mt := NewClient(apiKey, WithHTTPClient(&http.Client{Transport: &httpfixture.Recorder{Dir: fixtureDir}}))
+	if err := mt.Login(username, password); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	fetchFixtureResponses(t, mt)
+}
+
+func TestFixturesReplay(t *testing.T) {
+	if *record {
+		t.Skip("recording")
+	}
+
+	mt := NewClient("key",
+		WithBaseURL(DefaultBaseURL),
+		WithHTTPClient(&http.Client{Transport: &httpfixture.Replayer{Dir: fixtureDir}}),
+	)
+	mt.accessToken = "token"
+
+	res := fetchFixtureResponses(t, mt)
+
+	for _, account := range res.accounts {
+		if account.ID == 0 || account.Currency == "" || account.AccountType == "" {
+			t.Errorf("account not fully decoded: %+v", account)
+		}
+	}
+
+	if len(res.transactions) == 0 {
+		t.Fatal("no transactions decoded")
+	}
+	for _, tx := range res.transactions {
+		if tx.ID == 0 || tx.Date.IsZero() || tx.AccountID != res.accounts[0].ID {
+			t.Errorf("transaction not fully decoded: %+v", tx)
+		}
+		for _, attachment := range tx.TransactionAttachments {
+			if attachment.ID == 0 || attachment.TransactionID != tx.ID {
+				t.Errorf("attachment not fully decoded: %+v", attachment)
+			}
+		}
+	}
+
+	for _, position := range res.positions {
+		if position.ID == 0 || position.Date == "" {
+			t.Errorf("position not fully decoded: %+v", position)
+		}
+	}
+
+	if len(res.categories) == 0 {
+		t.Fatal("no categories decoded")
+	}
+	for _, category := range res.categories {
+		if category.ID == 0 || category.Name == "" {
+			t.Errorf("category not fully decoded: %+v", category)
+		}
+	}
+
+	if res.guest.ID == 0 || len(res.guest.Credentials) == 0 {
+		t.Fatalf("guest not fully decoded: %+v", res.guest)
+	}
+	for _, cred := range res.guest.Credentials {
+		if cred.ID == 0 || cred.Status == "" {
+			t.Errorf("credential not fully decoded: %+v", cred)
+		}
+		if cred.InError() && cred.ErrorInfo.IsEmpty() {
+			t.Errorf("credential %d is in error without error info", cred.ID)
+		}
+	}
+}
+
+func TestSanitizeRedactsIdentifyingFields(t *testing.T) {
+	got := string(httpfixture.Sanitize([]byte(`{"access_token":"secret","accounts":[{"id":1,"nickname":"My Bank","branch_name":null}]}`)))
+	want := `{"access_token":"REDACTED_ACCESS_TOKEN","accounts":[{"branch_name":null,"id":1,"nickname":"Nickname"}]}`
+	if got != want {
+		t.Errorf("Sanitize() = %s, want %s", got, want)
+	}
+}
+
+func TestFixtureFileName(t *testing.T) {
+	tests := []struct {
+		method, path, query string
+		want                string
+	}{
+		{"GET", "/v8/api/accounts.json", "", "GET_v8_api_accounts.json"},
+		{"GET", "/v8/api/accounts/1001/transactions.json", "since=2024-01-01&page=1", "GET_v8_api_accounts_1001_transactions_since=2024-01-01_page=1.json"},
+		{"POST", "/oauth/token", "", "POST_oauth_token.json"},
+		{"GET", "/v8/api/presenter/categories", "locale=en", "GET_v8_api_presenter_categories_locale=en.json"},
+	}
+
+	for _, tt := range tests {
+		if got := httpfixture.FileName(tt.method, tt.path, tt.query); got != tt.want {
+			t.Errorf("FileName(%q, %q, %q) = %q, want %q", tt.method, tt.path, tt.query, got, tt.want)
+		}
+	}
+}
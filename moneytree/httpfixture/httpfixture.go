@@ -0,0 +1,198 @@
+// Package httpfixture records Moneytree API responses to disk and replays
+// them, so the client can be tested offline against real response shapes.
+//
+// Recorded fixtures are sanitized before they are written: tokens, account
+// numbers, names and free-text descriptions are replaced with placeholders.
+// Request bodies and headers are never recorded, so passwords and bearer
+// tokens can't leak into testdata.
+package httpfixture
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Fixture is a single recorded request/response pair.
+type Fixture struct {
+	Method      string          `json:"method"`
+	Path        string          `json:"path"`
+	Query       string          `json:"query,omitempty"`
+	Status      int             `json:"status"`
+	ContentType string          `json:"content_type,omitempty"`
+	Body        json.RawMessage `json:"body,omitempty"`
+}
+
+// redactedKeys are JSON keys whose values identify the guest or grant access.
+var redactedKeys = map[string]string{
+	"access_token":               "REDACTED_ACCESS_TOKEN",
+	"refresh_token":              "REDACTED_REFRESH_TOKEN",
+	"institution_account_number": "0000000",
+	"institution_account_name":   "Account Name",
+	"nickname":                   "Nickname",
+	"branch_name":                "Branch",
+	"email":                      "guest@example.com",
+	"unconfirmed_email":          "guest@example.com",
+	"uid":                        "REDACTED_UID",
+	"intercom_user_hash":         "REDACTED_HASH",
+	"description_guest":          "Description",
+	"description_pretty":         "Description",
+	"description_raw":            "Description",
+	"url":                        "https://example.com/attachment",
+	"file_name":                  "attachment.jpg",
+}
+
+// Sanitize replaces identifying values in a JSON document with placeholders.
+// Null values stay null so the shape of the response is kept. Bodies that
+// aren't JSON are dropped entirely.
+func Sanitize(body []byte) json.RawMessage {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		return json.RawMessage(`"non-JSON body removed"`)
+	}
+
+	out, err := json.Marshal(sanitizeValue(doc))
+	if err != nil {
+		return nil
+	}
+
+	return out
+}
+
+func sanitizeValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if placeholder, ok := redactedKeys[key]; ok && value != nil {
+				v[key] = placeholder
+				continue
+			}
+			v[key] = sanitizeValue(value)
+		}
+		return v
+	case []interface{}:
+		for i, value := range v {
+			v[i] = sanitizeValue(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9=_.-]+`)
+
+// FileName is the fixture file a request maps to, derived from its method,
+// path and query. The extension of the path is dropped so that
+// /v8/api/accounts.json doesn't become GET_v8_api_accounts.json.json.
+func FileName(method, urlPath, query string) string {
+	urlPath = strings.TrimSuffix(urlPath, path.Ext(urlPath))
+	name := method + "_" + strings.Trim(urlPath, "/")
+	if query != "" {
+		name += "_" + query
+	}
+
+	return strings.Trim(unsafeChars.ReplaceAllString(name, "_"), "_") + ".json"
+}
+
+// Recorder is a RoundTripper that forwards requests to Transport and writes
+// a sanitized fixture for every response into Dir.
+type Recorder struct {
+	Dir       string
+	Transport http.RoundTripper
+}
+
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := r.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	fixture := Fixture{
+		Method:      req.Method,
+		Path:        req.URL.Path,
+		Query:       req.URL.RawQuery,
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Body:        Sanitize(body),
+	}
+
+	if err := writeFixture(r.Dir, fixture); err != nil {
+		return nil, fmt.Errorf("recording fixture: %w", err)
+	}
+
+	return resp, nil
+}
+
+func writeFixture(dir string, fixture Fixture) error {
+	data, err := json.MarshalIndent(fixture, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	return os.WriteFile(filepath.Join(dir, FileName(fixture.Method, fixture.Path, fixture.Query)), append(data, '\n'), 0o644)
+}
+
+// Replayer is a RoundTripper that answers requests from fixtures in Dir.
+// Requests without a fixture fail, so tests notice when the client starts
+// calling something new.
+type Replayer struct {
+	Dir string
+}
+
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	path := filepath.Join(r.Dir, FileName(req.Method, req.URL.Path, req.URL.RawQuery))
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no fixture for %s %s: %w", req.Method, req.URL.RequestURI(), err)
+	}
+
+	var fixture Fixture
+	if err := json.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("reading fixture %s: %w", path, err)
+	}
+
+	header := http.Header{}
+	if fixture.ContentType != "" {
+		header.Set("Content-Type", fixture.ContentType)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", fixture.Status, http.StatusText(fixture.Status)),
+		StatusCode:    fixture.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(fixture.Body)),
+		ContentLength: int64(len(fixture.Body)),
+		Request:       req,
+	}, nil
+}
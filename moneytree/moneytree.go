@@ -2,10 +2,15 @@ package moneytree
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 )
 
@@ -62,21 +67,44 @@ type GetAccountsResponse struct {
 }
 
 type MTTransaction struct {
-	ID                     int           `json:"id"`
-	Amount                 float64       `json:"amount"`
-	Date                   time.Time     `json:"date"`
-	DescriptionGuest       string        `json:"description_guest"`
-	DescriptionPretty      string        `json:"description_pretty"`
-	DescriptionRaw         string        `json:"description_raw"`
-	RawTransactionID       int           `json:"raw_transaction_id"`
-	AccountID              int           `json:"account_id"`
-	ClaimID                int           `json:"claim_id"`
-	CategoryID             int           `json:"category_id"`
-	ExpenseType            int           `json:"expense_type"`
-	PredictedExpenseType   int           `json:"predicted_expense_type"`
-	CreatedAt              string        `json:"created_at"`
-	UpdatedAt              string        `json:"updated_at"`
-	TransactionAttachments []interface{} `json:"transaction_attachments"`
+	ID                     int                       `json:"id"`
+	Amount                 float64                   `json:"amount"`
+	Date                   time.Time                 `json:"date"`
+	DescriptionGuest       string                    `json:"description_guest"`
+	DescriptionPretty      string                    `json:"description_pretty"`
+	DescriptionRaw         string                    `json:"description_raw"`
+	RawTransactionID       int                       `json:"raw_transaction_id"`
+	AccountID              int                       `json:"account_id"`
+	ClaimID                int                       `json:"claim_id"`
+	CategoryID             int                       `json:"category_id"`
+	ExpenseType            *int                      `json:"expense_type"`
+	PredictedExpenseType   *int                      `json:"predicted_expense_type"`
+	CreatedAt              string                    `json:"created_at"`
+	UpdatedAt              string                    `json:"updated_at"`
+	TransactionAttachments []MTTransactionAttachment `json:"transaction_attachments"`
+}
+
+// Expense types of transactions and categories. PredictedExpenseType is
+// Moneytree's own guess, ExpenseType is what's in effect, which differs from
+// the prediction when the guest reclassified the transaction in the app.
+// Both are nil on transactions Moneytree hasn't classified.
+const (
+	MTExpenseTypeExpense  = 0
+	MTExpenseTypeIncome   = 1
+	MTExpenseTypeTransfer = 2
+)
+
+// MTTransactionAttachment is a file attached to a transaction in the
+// Moneytree app, usually a photographed receipt.
+type MTTransactionAttachment struct {
+	ID            int    `json:"id"`
+	TransactionID int    `json:"transaction_id"`
+	FileName      string `json:"file_name"`
+	ContentType   string `json:"content_type"`
+	FileSize      int    `json:"file_size"`
+	URL           string `json:"url"`
+	CreatedAt     string `json:"created_at"`
+	UpdatedAt     string `json:"updated_at"`
 }
 
 type GetTransactionsResponse struct {
@@ -100,31 +128,159 @@ type MTPosition struct {
 	CostBasis         float64  `json:"cost_basis"`
 }
 
+// tokenRefreshMargin is how long before the reported expiry the access token
+// gets refreshed, so requests in flight don't race the deadline.
+const tokenRefreshMargin = time.Minute
+
+const (
+	DefaultBaseURL = "https://jp-api.getmoneytree.com"
+	DefaultAuthURL = "https://myaccount.getmoneytree.com"
+
+	appUserAgent     = "Moneytree/1.16.3 (Android 12; en_AU; Pixel 3)"
+	browserUserAgent = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.2 Safari/605.1.15"
+)
+
 type Moneytree struct {
-	apiKey string
+	apiKey      string
+	authURL     string
+	httpClient  *http.Client
+	userAgent   string
+	retryPolicy RetryPolicy
+
+	// mu guards the token fields below. It's held for the whole duration of a
+	// refresh so concurrent callers wait for the new token instead of each
+	// starting their own refresh_token grant.
+	mu sync.Mutex
+	// baseURL is the API resource server. Unless pinned through WithBaseURL
+	// or WithRegion, it follows the resource_server of the token response.
+	baseURL        string
+	baseURLPinned  bool
+	guestLogin     string
+	accessToken    string
+	refreshToken   string
+	tokenExpiresAt time.Time
+	resourceServer string
+	tokenStore     TokenStore
+}
 
-	accessToken  string
-	refreshToken string
+func NewClient(token string, opts ...Option) *Moneytree {
+	m := &Moneytree{
+		apiKey:      token,
+		baseURL:     DefaultBaseURL,
+		authURL:     DefaultAuthURL,
+		httpClient:  &http.Client{},
+		retryPolicy: DefaultRetryPolicy,
+	}
+
+	for _, opt := range opts {
+		opt(m)
+	}
+
+	return m
+}
+
+// apiBaseURL returns the base URL for API calls.
+func (m *Moneytree) apiBaseURL() string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.baseURL
 }
 
-func NewClient(token string) *Moneytree {
-	return &Moneytree{
-		apiKey: token,
+// useResourceServer switches API calls to the resource server named by a
+// token response, unless the base URL was pinned. m.mu must be held.
+func (m *Moneytree) useResourceServer(resourceServer string) {
+	if m.baseURLPinned || resourceServer == "" {
+		return
 	}
+
+	m.baseURL = normalizeBaseURL(resourceServer)
 }
 
-func (m *Moneytree) GetAccessToken(guestLogin, password string) (*GetAccessTokenResponse, error) {
-	url := "https://myaccount.getmoneytree.com/oauth/token"
-	headers := map[string]string{
-		"Accept":          "application/json",
-		"Host":            "myaccount.getmoneytree.com",
-		"Connection":      "Keep-Alive",
-		"User-Agent":      "Moneytree/1.16.3 (Android 12; en_AU; Pixel 3)",
-		"Accept-Language": "en-US-POSIX",
-		"locale":          "en-US-POSIX",
-		"Content-Type":    "application/json; charset=utf-8",
+// normalizeBaseURL turns a bare host like "jp-api.getmoneytree.com" into a
+// base URL without trailing slash.
+func normalizeBaseURL(server string) string {
+	server = strings.TrimRight(strings.TrimSpace(server), "/")
+	if !strings.Contains(server, "://") {
+		server = "https://" + server
 	}
 
+	return server
+}
+
+// userAgentOr returns the user agent set through WithUserAgent, or def if
+// none was set.
+func (m *Moneytree) userAgentOr(def string) string {
+	if m.userAgent != "" {
+		return m.userAgent
+	}
+
+	return def
+}
+
+// Login is LoginContext with context.Background().
+func (m *Moneytree) Login(guestLogin, password string) error {
+	return m.LoginContext(context.Background(), guestLogin, password)
+}
+
+// LoginContext authenticates the client. Tokens from the token store are
+// tried first: the cached access token, then the cached refresh token if the
+// access token is expired or rejected. The password grant is only used when
+// both fail.
+func (m *Moneytree) LoginContext(ctx context.Context, guestLogin, password string) error {
+	if m.loadStoredToken(guestLogin) {
+		// any authenticated call will do to check the cached tokens, it
+		// refreshes on its own when the access token is rejected
+		_, err := m.GetGuestMetaContext(ctx)
+		if err == nil {
+			return nil
+		}
+		if !IsAuthError(err) {
+			return err
+		}
+	}
+
+	_, err := m.GetAccessTokenContext(ctx, guestLogin, password)
+	return err
+}
+
+// loadStoredToken restores tokens for guestLogin from the token store and
+// reports whether anything usable was found.
+func (m *Moneytree) loadStoredToken(guestLogin string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.tokenStore == nil {
+		return false
+	}
+
+	// a broken cache file is treated like an empty one, it gets overwritten
+	// after the password grant
+	stored, err := m.tokenStore.Load()
+	if err != nil || stored == nil {
+		return false
+	}
+
+	if stored.GuestLogin != guestLogin || (stored.AccessToken == "" && stored.RefreshToken == "") {
+		return false
+	}
+
+	m.guestLogin = stored.GuestLogin
+	m.accessToken = stored.AccessToken
+	m.refreshToken = stored.RefreshToken
+	m.tokenExpiresAt = stored.ExpiresAt
+	m.resourceServer = stored.ResourceServer
+	m.useResourceServer(stored.ResourceServer)
+
+	return true
+}
+
+// GetAccessToken is GetAccessTokenContext with context.Background().
+func (m *Moneytree) GetAccessToken(guestLogin, password string) (*GetAccessTokenResponse, error) {
+	return m.GetAccessTokenContext(context.Background(), guestLogin, password)
+}
+
+func (m *Moneytree) GetAccessTokenContext(ctx context.Context, guestLogin, password string) (*GetAccessTokenResponse, error) {
 	body := map[string]string{
 		"client_id":   m.apiKey,
 		"grant_type":  "password",
@@ -132,7 +288,56 @@ func (m *Moneytree) GetAccessToken(guestLogin, password string) (*GetAccessToken
 		"password":    password,
 	}
 
-	resp, err := makeRequest("POST", url, headers, body)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.guestLogin = guestLogin
+	return m.requestToken(ctx, body)
+}
+
+// RefreshAccessToken is RefreshAccessTokenContext with context.Background().
+func (m *Moneytree) RefreshAccessToken() (*GetAccessTokenResponse, error) {
+	return m.RefreshAccessTokenContext(context.Background())
+}
+
+// RefreshAccessTokenContext exchanges the stored refresh token for a new
+// access token.
+func (m *Moneytree) RefreshAccessTokenContext(ctx context.Context) (*GetAccessTokenResponse, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.refreshLocked(ctx)
+}
+
+// refreshLocked runs the refresh_token grant. m.mu must be held.
+func (m *Moneytree) refreshLocked(ctx context.Context) (*GetAccessTokenResponse, error) {
+	if m.refreshToken == "" {
+		return nil, errors.New("moneytree: no refresh token available, call GetAccessToken first")
+	}
+
+	body := map[string]string{
+		"client_id":     m.apiKey,
+		"grant_type":    "refresh_token",
+		"refresh_token": m.refreshToken,
+	}
+
+	return m.requestToken(ctx, body)
+}
+
+// requestToken posts a grant to the token endpoint and stores the resulting
+// tokens on the client. m.mu must be held.
+func (m *Moneytree) requestToken(ctx context.Context, body map[string]string) (*GetAccessTokenResponse, error) {
+	url := m.authURL + "/oauth/token"
+	headers := map[string]string{
+		"Accept":          "application/json",
+		"Connection":      "Keep-Alive",
+		"User-Agent":      m.userAgentOr(appUserAgent),
+		"Accept-Language": "en-US-POSIX",
+		"locale":          "en-US-POSIX",
+		"Content-Type":    "application/json; charset=utf-8",
+	}
+
+	resp, err := m.makeRequest(ctx, "POST", url, headers, body)
 	if err != nil {
 		return nil, err
 	}
@@ -142,28 +347,133 @@ func (m *Moneytree) GetAccessToken(guestLogin, password string) (*GetAccessToken
 		return nil, err
 	}
 
+	if result.AccessToken == "" {
+		return nil, fmt.Errorf("moneytree: token response did not contain an access token: %s", resp)
+	}
+
 	m.accessToken = result.AccessToken
-	m.refreshToken = result.RefreshToken
+	if result.RefreshToken != "" {
+		m.refreshToken = result.RefreshToken
+	}
+	m.tokenExpiresAt = tokenExpiry(&result)
+	if result.ResourceServer != "" {
+		m.resourceServer = result.ResourceServer
+		m.useResourceServer(result.ResourceServer)
+	}
+
+	if m.tokenStore != nil {
+		err := m.tokenStore.Save(&StoredToken{
+			GuestLogin:     m.guestLogin,
+			AccessToken:    m.accessToken,
+			RefreshToken:   m.refreshToken,
+			ExpiresAt:      m.tokenExpiresAt,
+			ResourceServer: m.resourceServer,
+		})
+		// the token is good either way, the next run just logs in again
+		if err != nil {
+			log.Printf("moneytree: saving token to store: %v", err)
+		}
+	}
 
 	return &result, nil
 }
 
+// tokenExpiry returns when the token in res expires, or the zero time if the
+// response doesn't say.
+func tokenExpiry(res *GetAccessTokenResponse) time.Time {
+	if res.ExpiresIn <= 0 {
+		return time.Time{}
+	}
+
+	createdAt := time.Now()
+	if res.CreatedAt > 0 {
+		createdAt = time.Unix(int64(res.CreatedAt), 0)
+	}
+
+	return createdAt.Add(time.Duration(res.ExpiresIn) * time.Second)
+}
+
+// validAccessToken returns the current access token, refreshing it first if
+// it's about to expire.
+func (m *Moneytree) validAccessToken(ctx context.Context) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.accessToken == "" && m.refreshToken == "" {
+		return "", errors.New("moneytree: not authenticated, call GetAccessToken first")
+	}
+
+	expiring := !m.tokenExpiresAt.IsZero() && time.Now().Add(tokenRefreshMargin).After(m.tokenExpiresAt)
+	if (m.accessToken == "" || expiring) && m.refreshToken != "" {
+		if _, err := m.refreshLocked(ctx); err != nil {
+			return "", fmt.Errorf("refreshing expired access token: %w", err)
+		}
+	}
+
+	return m.accessToken, nil
+}
+
+// refreshAfterUnauthorized refreshes the access token after a request using
+// staleToken was rejected. If another goroutine already replaced the token in
+// the meantime, that token is returned without refreshing again.
+func (m *Moneytree) refreshAfterUnauthorized(ctx context.Context, staleToken string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.accessToken != staleToken {
+		return m.accessToken, nil
+	}
+
+	if _, err := m.refreshLocked(ctx); err != nil {
+		return "", err
+	}
+
+	return m.accessToken, nil
+}
+
+// authorizedRequest performs an API request with the current bearer token.
+// If the API rejects the token, it is refreshed and the request retried once.
+func (m *Moneytree) authorizedRequest(ctx context.Context, method, url string, headers map[string]string, body interface{}) ([]byte, error) {
+	token, err := m.validAccessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	headers["Authorization"] = "Bearer " + token
+	resp, err := m.sendRequest(ctx, method, url, headers, body)
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+
+	token, refreshErr := m.refreshAfterUnauthorized(ctx, token)
+	if refreshErr != nil {
+		return nil, fmt.Errorf("%w (token refresh failed: %v)", err, refreshErr)
+	}
+
+	headers["Authorization"] = "Bearer " + token
+	return m.sendRequest(ctx, method, url, headers, body)
+}
+
+// GetAccounts is GetAccountsContext with context.Background().
 func (m *Moneytree) GetAccounts() ([]MTAccount, error) {
-	url := "https://jp-api.getmoneytree.com/v8/api/accounts.json"
+	return m.GetAccountsContext(context.Background())
+}
+
+func (m *Moneytree) GetAccountsContext(ctx context.Context) ([]MTAccount, error) {
+	url := m.apiBaseURL() + "/v8/api/accounts.json"
 	headers := map[string]string{
 		"Accept-Language": "en_AU",
 		"locale":          "en_AU",
 		"X-Api-Key":       m.apiKey,
 		"X-Api-Version":   "20180814",
 		"Accept":          "application/json",
-		"User-Agent":      "Moneytree/1.16.3 (Android 12; en_AU; Pixel 3)",
-		"Authorization":   "Bearer " + m.accessToken,
-		"Host":            "jp-api.getmoneytree.com",
+		"User-Agent":      m.userAgentOr(appUserAgent),
 		"Connection":      "Keep-Alive",
 		"Content-Type":    "application/json",
 	}
 
-	resp, err := makeRequest("GET", url, headers, nil)
+	resp, err := m.authorizedRequest(ctx, "GET", url, headers, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -175,23 +485,26 @@ func (m *Moneytree) GetAccounts() ([]MTAccount, error) {
 	return result.Accounts, nil
 }
 
+// GetTransactions is GetTransactionsContext with context.Background().
 func (m *Moneytree) GetTransactions(accountID int, since string, page, perPage int) ([]*MTTransaction, error) {
-	url := fmt.Sprintf("https://jp-api.getmoneytree.com/v8/api/accounts/%d/transactions.json?since=%s&page=%d&per_page=%d",
-		accountID, since, page, perPage)
+	return m.GetTransactionsContext(context.Background(), accountID, since, page, perPage)
+}
+
+func (m *Moneytree) GetTransactionsContext(ctx context.Context, accountID int, since string, page, perPage int) ([]*MTTransaction, error) {
+	url := fmt.Sprintf("%s/v8/api/accounts/%d/transactions.json?since=%s&page=%d&per_page=%d",
+		m.apiBaseURL(), accountID, since, page, perPage)
 	headers := map[string]string{
 		"Accept-Language": "en_AU",
 		"locale":          "en_AU",
 		"X-Api-Key":       m.apiKey,
 		"X-Api-Version":   "20180814",
 		"Accept":          "application/json",
-		"User-Agent":      "Moneytree/1.16.3 (Android 12; en_AU; Pixel 3)",
-		"Authorization":   "Bearer " + m.accessToken,
-		"Host":            "jp-api.getmoneytree.com",
+		"User-Agent":      m.userAgentOr(appUserAgent),
 		"Connection":      "Keep-Alive",
 		"Content-Type":    "application/json",
 	}
 
-	resp, err := makeRequest("GET", url, headers, nil)
+	resp, err := m.authorizedRequest(ctx, "GET", url, headers, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -203,22 +516,25 @@ func (m *Moneytree) GetTransactions(accountID int, since string, page, perPage i
 	return result.Transactions, nil
 }
 
+// GetPositions is GetPositionsContext with context.Background().
 func (m *Moneytree) GetPositions(accountID string) ([]MTPosition, error) {
-	url := fmt.Sprintf("https://jp-api.getmoneytree.com/v8/api/accounts/%s/positions.json", accountID)
+	return m.GetPositionsContext(context.Background(), accountID)
+}
+
+func (m *Moneytree) GetPositionsContext(ctx context.Context, accountID string) ([]MTPosition, error) {
+	url := fmt.Sprintf("%s/v8/api/accounts/%s/positions.json", m.apiBaseURL(), accountID)
 	headers := map[string]string{
 		"Accept-Language": "en_AU",
 		"locale":          "en_AU",
 		"X-Api-Key":       m.apiKey,
 		"X-Api-Version":   "20180814",
 		"Accept":          "application/json",
-		"User-Agent":      "Moneytree/1.16.3 (Android 12; en_AU; Pixel 3)",
-		"Authorization":   "Bearer " + m.accessToken,
-		"Host":            "jp-api.getmoneytree.com",
+		"User-Agent":      m.userAgentOr(appUserAgent),
 		"Connection":      "Keep-Alive",
 		"Content-Type":    "application/json",
 	}
 
-	resp, err := makeRequest("GET", url, headers, nil)
+	resp, err := m.authorizedRequest(ctx, "GET", url, headers, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -230,22 +546,25 @@ func (m *Moneytree) GetPositions(accountID string) ([]MTPosition, error) {
 	return result, nil
 }
 
+// RefreshAllCredentials is RefreshAllCredentialsContext with context.Background().
 func (m *Moneytree) RefreshAllCredentials() (interface{}, error) {
-	url := "https://jp-api.getmoneytree.com/v8/api/credentials/refresh.json"
+	return m.RefreshAllCredentialsContext(context.Background())
+}
+
+func (m *Moneytree) RefreshAllCredentialsContext(ctx context.Context) (interface{}, error) {
+	url := m.apiBaseURL() + "/v8/api/credentials/refresh.json"
 	headers := map[string]string{
 		"Accept-Language": "en_AU",
 		"locale":          "en_AU",
 		"X-Api-Key":       m.apiKey,
 		"X-Api-Version":   "20180814",
 		"Accept":          "application/json",
-		"User-Agent":      "Moneytree/1.16.3 (Android 12; en_AU; Pixel 3)",
-		"Authorization":   "Bearer " + m.accessToken,
-		"Host":            "jp-api.getmoneytree.com",
+		"User-Agent":      m.userAgentOr(appUserAgent),
 		"Connection":      "Keep-Alive",
 		"Content-Type":    "application/json",
 	}
 
-	resp, err := makeRequest("PUT", url, headers, nil)
+	resp, err := m.authorizedRequest(ctx, "PUT", url, headers, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -257,12 +576,45 @@ func (m *Moneytree) RefreshAllCredentials() (interface{}, error) {
 	return result, nil
 }
 
-// makeRequest is a helper function that would need to be implemented
-// to handle the actual HTTP requests
-func makeRequest(method, url string, headers map[string]string, body interface{}) ([]byte, error) {
+// RefreshCredential is RefreshCredentialContext with context.Background().
+func (m *Moneytree) RefreshCredential(credentialID int) (interface{}, error) {
+	return m.RefreshCredentialContext(context.Background(), credentialID)
+}
 
-	client := &http.Client{}
+// RefreshCredentialContext asks Moneytree to re-aggregate a single credential,
+// leaving all other banks alone.
+func (m *Moneytree) RefreshCredentialContext(ctx context.Context, credentialID int) (interface{}, error) {
+	url := fmt.Sprintf("%s/v8/api/credentials/%d/refresh.json", m.apiBaseURL(), credentialID)
+	headers := map[string]string{
+		"Accept-Language": "en_AU",
+		"locale":          "en_AU",
+		"X-Api-Key":       m.apiKey,
+		"X-Api-Version":   "20180814",
+		"Accept":          "application/json",
+		"User-Agent":      m.userAgentOr(appUserAgent),
+		"Connection":      "Keep-Alive",
+		"Content-Type":    "application/json",
+	}
+
+	resp, err := m.authorizedRequest(ctx, "PUT", url, headers, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp) == 0 {
+		return nil, nil
+	}
+
+	var result interface{}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
 
+// makeRequest sends a request with the client's http.Client and returns the
+// response body, or an *APIError for non-2xx responses.
+func (m *Moneytree) makeRequest(ctx context.Context, method, url string, headers map[string]string, body interface{}) ([]byte, error) {
 	var req *http.Request
 	var err error
 
@@ -271,9 +623,9 @@ func makeRequest(method, url string, headers map[string]string, body interface{}
 		if err != nil {
 			return nil, err
 		}
-		req, err = http.NewRequest(method, url, bytes.NewBuffer(jsonBody))
+		req, err = http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(jsonBody))
 	} else {
-		req, err = http.NewRequest(method, url, nil)
+		req, err = http.NewRequestWithContext(ctx, method, url, nil)
 	}
 
 	if err != nil {
@@ -284,13 +636,22 @@ func makeRequest(method, url string, headers map[string]string, body interface{}
 		req.Header.Set(key, value)
 	}
 
-	resp, err := client.Do(req)
+	resp, err := m.httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
 	defer resp.Body.Close()
 
-	return io.ReadAll(resp.Body)
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, newAPIError(req, resp, respBody)
+	}
+
+	return respBody, nil
 }
 
 type MTCategory struct {
@@ -305,21 +666,24 @@ type GetCategoriesResponse struct {
 	Categories []MTCategory `json:"categories"`
 }
 
+// GetCategories is GetCategoriesContext with context.Background().
 func (m *Moneytree) GetCategories() ([]MTCategory, error) {
-	url := "https://jp-api.getmoneytree.com/v8/api/presenter/categories.json?locale=en"
+	return m.GetCategoriesContext(context.Background())
+}
+
+func (m *Moneytree) GetCategoriesContext(ctx context.Context) ([]MTCategory, error) {
+	url := m.apiBaseURL() + "/v8/api/presenter/categories.json?locale=en"
 	headers := map[string]string{
 		"Accept-Language": "en-US,en;q=0.9",
 		"X-Api-Key":       m.apiKey,
 		"X-Api-Version":   "6",
 		"Accept":          "application/json",
-		"User-Agent":      "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/18.2 Safari/605.1.15",
-		"Authorization":   "Bearer " + m.accessToken,
-		"Host":            "jp-api.getmoneytree.com",
+		"User-Agent":      m.userAgentOr(browserUserAgent),
 		"Connection":      "Keep-Alive",
 		"Content-Type":    "application/json",
 	}
 
-	resp, err := makeRequest("GET", url, headers, nil)
+	resp, err := m.authorizedRequest(ctx, "GET", url, headers, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -336,19 +700,46 @@ type MTInstitution struct {
 }
 
 type MTCredential struct {
-	ID                          int           `json:"id"`
-	AdditionalStatusInformation interface{}   `json:"additional_status_information"`
-	ErrorInfo                   interface{}   `json:"error_info"`
-	LastSuccess                 string        `json:"last_success"`
-	StatusSetAt                 string        `json:"status_set_at"`
-	InstitutionName             string        `json:"institution_name"`
-	BackgroundRefreshFrequency  int           `json:"background_refresh_frequency"`
-	AuthType                    int           `json:"auth_type"`
-	Status                      string        `json:"status"`
-	AutoRun                     bool          `json:"auto_run"`
-	UsesCertificate             bool          `json:"uses_certificate"`
-	Institution                 MTInstitution `json:"institution"`
-	Accounts                    []MTAccount   `json:"accounts"`
+	ID                          int                            `json:"id"`
+	AdditionalStatusInformation *MTAdditionalStatusInformation `json:"additional_status_information"`
+	ErrorInfo                   *MTCredentialErrorInfo         `json:"error_info"`
+	LastSuccess                 string                         `json:"last_success"`
+	StatusSetAt                 string                         `json:"status_set_at"`
+	InstitutionName             string                         `json:"institution_name"`
+	BackgroundRefreshFrequency  int                            `json:"background_refresh_frequency"`
+	AuthType                    int                            `json:"auth_type"`
+	Status                      string                         `json:"status"`
+	AutoRun                     bool                           `json:"auto_run"`
+	UsesCertificate             bool                           `json:"uses_certificate"`
+	Institution                 MTInstitution                  `json:"institution"`
+	Accounts                    []MTAccount                    `json:"accounts"`
+}
+
+// MTAuthTypeStandard is the AuthType of credentials that log in with stored
+// credentials alone. Other auth types need the guest to step in (OTP, token
+// generators, ...) and tend to get locked when refreshed unattended.
+const MTAuthTypeStandard = 0
+
+// NeedsInteractiveAuth reports whether refreshing the credential needs a
+// certificate or one-time password from the guest.
+func (c *MTCredential) NeedsInteractiveAuth() bool {
+	return c.UsesCertificate || c.AuthType != MTAuthTypeStandard
+}
+
+// RefreshedRecently reports whether the credential's last successful refresh
+// is more recent than its background refresh frequency (in hours), meaning
+// Moneytree will pick it up on its own.
+func (c *MTCredential) RefreshedRecently(now time.Time) bool {
+	if c.BackgroundRefreshFrequency <= 0 {
+		return false
+	}
+
+	lastSuccess, err := parseTimestamp(c.LastSuccess)
+	if err != nil {
+		return false
+	}
+
+	return now.Sub(lastSuccess) < time.Duration(c.BackgroundRefreshFrequency)*time.Hour
 }
 
 type MTGuest struct {
@@ -373,22 +764,25 @@ type GetGuestResponse struct {
 	Guest MTGuest `json:"guest"`
 }
 
+// GetGuestMeta is GetGuestMetaContext with context.Background().
 func (m *Moneytree) GetGuestMeta() (*MTGuest, error) {
-	url := "https://jp-api.getmoneytree.com/v8/api/presenter/guests.json"
+	return m.GetGuestMetaContext(context.Background())
+}
+
+func (m *Moneytree) GetGuestMetaContext(ctx context.Context) (*MTGuest, error) {
+	url := m.apiBaseURL() + "/v8/api/presenter/guests.json"
 	headers := map[string]string{
 		"Accept-Language": "en_AU",
 		"locale":          "en_AU",
 		"X-Api-Key":       m.apiKey,
 		"X-Api-Version":   "20180814",
 		"Accept":          "application/json",
-		"User-Agent":      "Moneytree/1.16.3 (Android 12; en_AU; Pixel 3)",
-		"Authorization":   "Bearer " + m.accessToken,
-		"Host":            "jp-api.getmoneytree.com",
+		"User-Agent":      m.userAgentOr(appUserAgent),
 		"Connection":      "Keep-Alive",
 		"Content-Type":    "application/json",
 	}
 
-	resp, err := makeRequest("GET", url, headers, nil)
+	resp, err := m.authorizedRequest(ctx, "GET", url, headers, nil)
 	if err != nil {
 		return nil, err
 	}
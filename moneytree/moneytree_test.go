@@ -0,0 +1,311 @@
+package moneytree
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientRefreshesTokenAfterUnauthorized(t *testing.T) {
+	var refreshes atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+		json.NewDecoder(r.Body).Decode(&body)
+
+		switch body["grant_type"] {
+		case "password":
+			w.Write([]byte(`{"access_token":"stale","refresh_token":"refresh-1","expires_in":7200}`))
+		case "refresh_token":
+			refreshes.Add(1)
+			if body["refresh_token"] != "refresh-1" {
+				t.Errorf("refresh_token = %q, want refresh-1", body["refresh_token"])
+			}
+			w.Write([]byte(`{"access_token":"fresh","refresh_token":"refresh-2","expires_in":7200}`))
+		default:
+			t.Errorf("unexpected grant_type %q", body["grant_type"])
+		}
+	})
+	mux.HandleFunc("/v8/api/accounts.json", func(w http.ResponseWriter, r *http.Request) {
+		if got := r.Header.Get("User-Agent"); got != "test-agent" {
+			t.Errorf("User-Agent = %q, want test-agent", got)
+		}
+		if r.Header.Get("Authorization") != "Bearer fresh" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"error":"invalid_token"}`))
+			return
+		}
+		w.Write([]byte(`{"accounts":[{"id":1,"institution_account_name":"Savings"}]}`))
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mt := NewClient("key", WithBaseURL(srv.URL), WithAuthURL(srv.URL), WithHTTPClient(srv.Client()), WithUserAgent("test-agent"))
+	if _, err := mt.GetAccessToken("guest", "password"); err != nil {
+		t.Fatalf("GetAccessToken() error = %v", err)
+	}
+
+	accounts, err := mt.GetAccounts()
+	if err != nil {
+		t.Fatalf("GetAccounts() error = %v", err)
+	}
+	if len(accounts) != 1 || accounts[0].InstitutionAccountName != "Savings" {
+		t.Errorf("GetAccounts() = %+v", accounts)
+	}
+	if got := refreshes.Load(); got != 1 {
+		t.Errorf("refreshes = %d, want 1", got)
+	}
+}
+
+func TestConcurrentCallersShareOneRefresh(t *testing.T) {
+	tests := []struct {
+		name      string
+		expiresAt time.Time
+	}{
+		{"expiring token", time.Now().Add(time.Second)},
+		{"token rejected with 401", time.Now().Add(time.Hour)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var refreshes atomic.Int32
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+				refreshes.Add(1)
+				// give the other callers time to pile up behind the refresh
+				time.Sleep(20 * time.Millisecond)
+				w.Write([]byte(`{"access_token":"fresh","refresh_token":"refresh-2","expires_in":7200}`))
+			})
+			mux.HandleFunc("/v8/api/accounts.json", func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Authorization") != "Bearer fresh" {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.Write([]byte(`{"accounts":[]}`))
+			})
+
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			mt := NewClient("key", WithBaseURL(srv.URL), WithAuthURL(srv.URL))
+			mt.accessToken = "stale"
+			mt.refreshToken = "refresh-1"
+			mt.tokenExpiresAt = tt.expiresAt
+
+			var wg sync.WaitGroup
+			for range 10 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := mt.GetAccounts(); err != nil {
+						t.Errorf("GetAccounts() error = %v", err)
+					}
+				}()
+			}
+			wg.Wait()
+
+			if got := refreshes.Load(); got != 1 {
+				t.Errorf("refresh_token grants = %d, want 1", got)
+			}
+		})
+	}
+}
+
+func TestClientRetriesOnlyIdempotentRequests(t *testing.T) {
+	var gets, puts atomic.Int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v8/api/accounts.json", func(w http.ResponseWriter, r *http.Request) {
+		if gets.Add(1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"accounts":[]}`))
+	})
+	mux.HandleFunc("/v8/api/credentials/refresh.json", func(w http.ResponseWriter, r *http.Request) {
+		puts.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mt := NewClient("key", WithBaseURL(srv.URL), WithRetryPolicy(RetryPolicy{MaxRetries: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}))
+	mt.accessToken = "token"
+
+	if _, err := mt.GetAccounts(); err != nil {
+		t.Fatalf("GetAccounts() error = %v", err)
+	}
+	if got := gets.Load(); got != 3 {
+		t.Errorf("GET attempts = %d, want 3", got)
+	}
+
+	if _, err := mt.RefreshAllCredentials(); err == nil {
+		t.Fatal("RefreshAllCredentials() error = nil, want error")
+	}
+	if got := puts.Load(); got != 1 {
+		t.Errorf("PUT attempts = %d, want 1", got)
+	}
+}
+
+func TestBackoffGivesUpOnLongRetryAfter(t *testing.T) {
+	policy := RetryPolicy{MaxRetries: 3, BaseDelay: time.Second, MaxDelay: 30 * time.Second}
+
+	if delay, ok := policy.backoff(0, &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: 10 * time.Second}); !ok || delay != 10*time.Second {
+		t.Errorf("backoff(Retry-After 10s) = %v, %t, want 10s, true", delay, ok)
+	}
+	if _, ok := policy.backoff(0, &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Hour}); ok {
+		t.Error("backoff(Retry-After 1h) ok = true, want false with MaxDelay 30s")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if got := parseRetryAfter("7"); got != 7*time.Second {
+		t.Errorf("parseRetryAfter(7) = %v, want 7s", got)
+	}
+	if got := parseRetryAfter("soon"); got != 0 {
+		t.Errorf("parseRetryAfter(soon) = %v, want 0", got)
+	}
+	future := time.Now().Add(time.Minute).UTC().Format(http.TimeFormat)
+	if got := parseRetryAfter(future); got <= 0 || got > time.Minute {
+		t.Errorf("parseRetryAfter(%q) = %v, want within a minute", future, got)
+	}
+}
+
+func TestTransactionsIteratesPagesLazily(t *testing.T) {
+	var pages atomic.Int32
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		pages.Add(1)
+		switch r.URL.Query().Get("page") {
+		case "1":
+			w.Write([]byte(`{"transactions":[{"id":1},{"id":2}]}`))
+		case "2":
+			w.Write([]byte(`{"transactions":[{"id":3}]}`))
+		default:
+			w.Write([]byte(`{"transactions":[]}`))
+		}
+	}))
+	defer srv.Close()
+
+	mt := NewClient("key", WithBaseURL(srv.URL))
+	mt.accessToken = "token"
+
+	var ids []int
+	for tx, err := range mt.Transactions(context.Background(), 42, "2024-01-01") {
+		if err != nil {
+			t.Fatalf("Transactions() error = %v", err)
+		}
+		ids = append(ids, tx.ID)
+	}
+	if len(ids) != 3 || pages.Load() != 3 {
+		t.Errorf("got ids %v from %d pages, want 3 ids from 3 pages", ids, pages.Load())
+	}
+
+	pages.Store(0)
+	for range mt.Transactions(context.Background(), 42, "2024-01-01") {
+		break
+	}
+	if got := pages.Load(); got != 1 {
+		t.Errorf("pages fetched after break = %d, want 1", got)
+	}
+}
+
+func TestClientFollowsResourceServer(t *testing.T) {
+	var srv *httptest.Server
+	mux := http.NewServeMux()
+	mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(GetAccessTokenResponse{AccessToken: "token", ExpiresIn: 7200, ResourceServer: srv.URL})
+	})
+	mux.HandleFunc("/v8/api/accounts.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"accounts":[{"id":7}]}`))
+	})
+	srv = httptest.NewServer(mux)
+	defer srv.Close()
+
+	mt := NewClient("key", WithAuthURL(srv.URL))
+	if _, err := mt.GetAccessToken("guest", "password"); err != nil {
+		t.Fatalf("GetAccessToken() error = %v", err)
+	}
+
+	accounts, err := mt.GetAccounts()
+	if err != nil {
+		t.Fatalf("GetAccounts() error = %v", err)
+	}
+	if len(accounts) != 1 || accounts[0].ID != 7 {
+		t.Errorf("GetAccounts() = %+v, want account 7 from the resource server", accounts)
+	}
+}
+
+func TestDownloadAttachment(t *testing.T) {
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte("api-file"))
+	}))
+	defer api.Close()
+
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "" {
+			t.Error("pre-signed download must not carry the bearer token")
+		}
+		w.Write([]byte("signed-file"))
+	}))
+	defer storage.Close()
+
+	mt := NewClient("key", WithBaseURL(api.URL))
+	mt.accessToken = "token"
+
+	for attachment, want := range map[MTTransactionAttachment]string{
+		{ID: 1, URL: "/v8/api/attachments/1/download"}:     "api-file",
+		{ID: 2, URL: storage.URL + "/receipt.jpg?sig=abc"}: "signed-file",
+	} {
+		got, err := mt.DownloadAttachment(attachment)
+		if err != nil {
+			t.Fatalf("DownloadAttachment(%d) error = %v", attachment.ID, err)
+		}
+		if string(got) != want {
+			t.Errorf("DownloadAttachment(%d) = %q, want %q", attachment.ID, got, want)
+		}
+	}
+}
+
+func TestUpdateTransactionDescriptionRequest(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut || r.URL.Path != "/v8/api/accounts/42/transactions/7.json" {
+			t.Errorf("request = %s %s, want PUT /v8/api/accounts/42/transactions/7.json", r.Method, r.URL.Path)
+		}
+
+		var body map[string]map[string]string
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Fatalf("decoding body: %v", err)
+		}
+		if got := body["transaction"]["description_guest"]; got != "7-Eleven" || len(body) != 1 || len(body["transaction"]) != 1 {
+			t.Errorf("body = %v, want only transaction.description_guest = 7-Eleven", body)
+		}
+
+		w.Write([]byte(`{"transaction":{"id":7,"description_guest":"7-Eleven"}}`))
+	}))
+	defer srv.Close()
+
+	mt := NewClient("key", WithBaseURL(srv.URL))
+	mt.accessToken = "token"
+
+	tx, err := mt.UpdateTransactionDescription(42, 7, "7-Eleven")
+	if err != nil {
+		t.Fatalf("UpdateTransactionDescription() error = %v", err)
+	}
+	if tx.ID != 7 || tx.DescriptionGuest != "7-Eleven" {
+		t.Errorf("UpdateTransactionDescription() = %+v", tx)
+	}
+}
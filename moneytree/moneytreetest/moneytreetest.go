@@ -0,0 +1,421 @@
+// Package moneytreetest is a fake Moneytree API for integration tests and
+// demos. It serves the endpoints the sync uses from a Scenario, and can
+// script credential refreshes and inject failures so the refresh-wait and
+// retry logic can be exercised end to end.
+package moneytreetest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+)
+
+// Scenario is the data the fake server serves. It is usually loaded from a
+// JSON file with LoadScenario.
+type Scenario struct {
+	// Username and Password are the only credentials the password grant
+	// accepts. Empty accepts anything.
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// TokenExpiresIn is the access token lifetime in seconds. Defaults to
+	// two hours.
+	TokenExpiresIn int `json:"token_expires_in,omitempty"`
+
+	Guest      moneytree.MTGuest      `json:"guest"`
+	Accounts   []moneytree.MTAccount  `json:"accounts"`
+	Categories []moneytree.MTCategory `json:"categories"`
+	// Transactions and Positions are keyed by account ID.
+	Transactions map[int][]moneytree.MTTransaction `json:"transactions"`
+	Positions    map[int][]moneytree.MTPosition    `json:"positions"`
+
+	// Refreshes scripts what happens after a refresh of a credential is
+	// requested: each poll of the guest endpoint moves the credential to
+	// the next step. Credentials without a script go through "running" and
+	// then "success".
+	Refreshes map[int][]CredentialStep `json:"refreshes,omitempty"`
+	// Failures are returned instead of the real response for matching
+	// requests.
+	Failures []Failure `json:"failures,omitempty"`
+}
+
+// CredentialStep is one status a credential passes through while refreshing.
+type CredentialStep struct {
+	Status    string                           `json:"status"`
+	ErrorInfo *moneytree.MTCredentialErrorInfo `json:"error_info,omitempty"`
+}
+
+// Failure injects an error response.
+type Failure struct {
+	// Method and Path select the requests to fail. An empty Method matches
+	// any method.
+	Method string `json:"method,omitempty"`
+	Path   string `json:"path"`
+	Status int    `json:"status"`
+	// Times is how many matching requests fail before the real response is
+	// served again. Zero fails every request.
+	Times      int             `json:"times,omitempty"`
+	RetryAfter string          `json:"retry_after,omitempty"`
+	Body       json.RawMessage `json:"body,omitempty"`
+}
+
+// LoadScenario reads a scenario from a JSON file.
+func LoadScenario(path string) (Scenario, error) {
+	var scenario Scenario
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return scenario, err
+	}
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		return scenario, fmt.Errorf("parsing scenario %s: %w", path, err)
+	}
+
+	return scenario, nil
+}
+
+var defaultRefresh = []CredentialStep{{Status: "running"}, {Status: moneytree.CredentialStatusSuccess}}
+
+// Server is an http.Handler serving a Scenario. It is safe for concurrent
+// use.
+type Server struct {
+	// URL is the address the server is reachable at, for NewClient. Set
+	// it after starting a listener with the server as its handler.
+	URL string
+
+	mu           sync.Mutex
+	scenario     Scenario
+	tokens       int
+	accessToken  string
+	refreshToken string
+	refreshing   map[int][]CredentialStep
+	failures     []int
+	requests     []string
+	mux          *http.ServeMux
+}
+
+// New returns a server for scenario. Use it as the handler of a listener,
+// such as an httptest.Server in tests.
+func New(scenario Scenario) *Server {
+	s := &Server{
+		scenario:   scenario,
+		refreshing: map[int][]CredentialStep{},
+		failures:   make([]int, len(scenario.Failures)),
+		mux:        http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("POST /oauth/token", s.handleToken)
+	s.mux.HandleFunc("GET /v8/api/accounts.json", s.authorized(s.handleAccounts))
+	s.mux.HandleFunc("GET /v8/api/accounts/{id}/transactions.json", s.authorized(s.handleTransactions))
+	s.mux.HandleFunc("GET /v8/api/accounts/{id}/positions.json", s.authorized(s.handlePositions))
+	s.mux.HandleFunc("GET /v8/api/presenter/guests.json", s.authorized(s.handleGuest))
+	s.mux.HandleFunc("GET /v8/api/presenter/categories.json", s.authorized(s.handleCategories))
+	s.mux.HandleFunc("PUT /v8/api/credentials/refresh.json", s.authorized(s.handleRefreshAll))
+	s.mux.HandleFunc("PUT /v8/api/credentials/{id}/refresh.json", s.authorized(s.handleRefresh))
+
+	return s
+}
+
+// NewClient returns a Moneytree client talking to the server at URL. Retries don't wait, so injected failures don't slow tests down.
+func (s *Server) NewClient(opts ...moneytree.Option) *moneytree.Moneytree {
+	opts = append([]moneytree.Option{
+		moneytree.WithBaseURL(s.URL),
+		moneytree.WithAuthURL(s.URL),
+		moneytree.WithRetryPolicy(moneytree.RetryPolicy{MaxRetries: moneytree.DefaultRetryPolicy.MaxRetries}),
+	}, opts...)
+
+	return moneytree.NewClient("fake-api-key", opts...)
+}
+
+// Requests returns every request served so far as "METHOD /path?query".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+// Credential returns the current state of a credential.
+func (s *Server) Credential(id int) (moneytree.MTCredential, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, credential := range s.scenario.Guest.Credentials {
+		if credential.ID == id {
+			return credential, true
+		}
+	}
+
+	return moneytree.MTCredential{}, false
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Method+" "+r.URL.RequestURI())
+	failure := s.takeFailure(r)
+	s.mu.Unlock()
+
+	if failure != nil {
+		if failure.RetryAfter != "" {
+			w.Header().Set("Retry-After", failure.RetryAfter)
+		}
+		body := failure.Body
+		if len(body) == 0 {
+			body = json.RawMessage(fmt.Sprintf(`{"error":%q}`, http.StatusText(failure.Status)))
+		}
+		writeRaw(w, failure.Status, body)
+		return
+	}
+
+	s.mux.ServeHTTP(w, r)
+}
+
+// takeFailure returns the injected failure for r, if any. s.mu must be held.
+func (s *Server) takeFailure(r *http.Request) *Failure {
+	for i := range s.scenario.Failures {
+		failure := &s.scenario.Failures[i]
+		if failure.Path != r.URL.Path || (failure.Method != "" && failure.Method != r.Method) {
+			continue
+		}
+		if failure.Times > 0 && s.failures[i] >= failure.Times {
+			continue
+		}
+
+		s.failures[i]++
+		return failure
+	}
+
+	return nil
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	var body map[string]string
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch body["grant_type"] {
+	case "password":
+		if (s.scenario.Username != "" && body["guest_login"] != s.scenario.Username) ||
+			(s.scenario.Password != "" && body["password"] != s.scenario.Password) {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_grant", "error_description": "wrong username or password"})
+			return
+		}
+	case "refresh_token":
+		if s.refreshToken == "" || body["refresh_token"] != s.refreshToken {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_grant", "error_description": "refresh token is invalid"})
+			return
+		}
+	default:
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	s.tokens++
+	s.accessToken = fmt.Sprintf("fake-access-token-%d", s.tokens)
+	s.refreshToken = fmt.Sprintf("fake-refresh-token-%d", s.tokens)
+
+	expiresIn := s.scenario.TokenExpiresIn
+	if expiresIn <= 0 {
+		expiresIn = 7200
+	}
+
+	writeJSON(w, http.StatusOK, moneytree.GetAccessTokenResponse{
+		AccessToken:  s.accessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    expiresIn,
+		RefreshToken: s.refreshToken,
+		CreatedAt:    int(time.Now().Unix()),
+		// point clients that follow the resource server back at us
+		ResourceServer: "http://" + r.Host,
+	})
+}
+
+// authorized rejects requests without the current access token.
+func (s *Server) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		ok := s.accessToken != "" && r.Header.Get("Authorization") == "Bearer "+s.accessToken
+		s.mu.Unlock()
+
+		if !ok {
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+func (s *Server) handleAccounts(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, moneytree.GetAccountsResponse{Accounts: s.scenario.Accounts})
+}
+
+func (s *Server) handleTransactions(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+	page, _ := strconv.Atoi(query.Get("page"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(query.Get("per_page"))
+	if perPage < 1 {
+		perPage = moneytree.TransactionsPageSize
+	}
+	since := query.Get("since")
+	if _, err := time.Parse(time.DateOnly, since); since != "" && err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid since"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matching []*moneytree.MTTransaction
+	for i := range s.scenario.Transactions[accountID] {
+		tx := s.scenario.Transactions[accountID][i]
+		// compare dates in the transaction's own time zone, like Moneytree does
+		if tx.Date.Format(time.DateOnly) >= since {
+			matching = append(matching, &tx)
+		}
+	}
+
+	start := min((page-1)*perPage, len(matching))
+	end := min(start+perPage, len(matching))
+	writeJSON(w, http.StatusOK, moneytree.GetTransactionsResponse{Transactions: append([]*moneytree.MTTransaction{}, matching[start:end]...)})
+}
+
+func (s *Server) handlePositions(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	positions := s.scenario.Positions[accountID]
+	if positions == nil {
+		positions = []moneytree.MTPosition{}
+	}
+	writeJSON(w, http.StatusOK, positions)
+}
+
+func (s *Server) handleCategories(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, moneytree.GetCategoriesResponse{Categories: s.scenario.Categories})
+}
+
+// handleGuest serves the guest with its credentials, moving every refreshing
+// credential one step further through its script.
+func (s *Server) handleGuest(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now().Format(time.RFC3339)
+	for i := range s.scenario.Guest.Credentials {
+		credential := &s.scenario.Guest.Credentials[i]
+		steps := s.refreshing[credential.ID]
+		if len(steps) == 0 {
+			continue
+		}
+
+		step := steps[0]
+		s.refreshing[credential.ID] = steps[1:]
+
+		credential.Status = step.Status
+		credential.ErrorInfo = step.ErrorInfo
+		credential.StatusSetAt = now
+		if step.Status == moneytree.CredentialStatusSuccess {
+			credential.LastSuccess = now
+		}
+	}
+
+	writeJSON(w, http.StatusOK, moneytree.GetGuestResponse{Guest: s.scenario.Guest})
+}
+
+func (s *Server) handleRefreshAll(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, credential := range s.scenario.Guest.Credentials {
+		s.startRefresh(credential.ID)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{})
+}
+
+func (s *Server) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.startRefresh(id) {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found"})
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// startRefresh queues a refresh of credential id. s.mu must be held.
+func (s *Server) startRefresh(id int) bool {
+	for i := range s.scenario.Guest.Credentials {
+		credential := &s.scenario.Guest.Credentials[i]
+		if credential.ID != id {
+			continue
+		}
+
+		steps, ok := s.scenario.Refreshes[id]
+		if !ok {
+			steps = defaultRefresh
+		}
+		s.refreshing[id] = append([]CredentialStep(nil), steps...)
+		credential.Status = "queued"
+
+		return true
+	}
+
+	return false
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	writeRaw(w, status, data)
+}
+
+func writeRaw(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(body)
+}
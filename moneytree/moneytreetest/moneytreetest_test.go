@@ -0,0 +1,120 @@
+package moneytreetest
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+)
+
+// start serves scenario on a local test server that is closed when the test
+// ends.
+func start(tb testing.TB, scenario Scenario) *Server {
+	tb.Helper()
+
+	s := New(scenario)
+	ts := httptest.NewServer(s)
+	tb.Cleanup(ts.Close)
+	s.URL = ts.URL
+
+	return s
+}
+
+func startScenario(t *testing.T) (*Server, *moneytree.Moneytree) {
+	t.Helper()
+
+	scenario, err := LoadScenario("testdata/scenario.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := start(t, scenario)
+	mt := s.NewClient()
+	if err := mt.Login("demo@example.com", "demo"); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	return s, mt
+}
+
+func TestRefreshWaitEndToEnd(t *testing.T) {
+	s, mt := startScenario(t)
+	ctx := context.Background()
+
+	since := time.Now()
+	if _, err := mt.RefreshAllCredentialsContext(ctx); err != nil {
+		t.Fatalf("RefreshAllCredentials: %v", err)
+	}
+
+	result, err := mt.WaitForRefresh(ctx, moneytree.WaitOptions{
+		Since:        since,
+		Timeout:      5 * time.Second,
+		PollInterval: time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("WaitForRefresh: %v", err)
+	}
+
+	if !result.Done() {
+		t.Fatalf("refresh not done, pending: %+v", result.Pending)
+	}
+	if len(result.Succeeded) != 1 || result.Succeeded[0].ID != 501 {
+		t.Errorf("Succeeded = %+v, want credential 501", result.Succeeded)
+	}
+	if len(result.Failed) != 1 || !result.Failed[0].NeedsReauth() {
+		t.Errorf("Failed = %+v, want credential 502 needing re-authentication", result.Failed)
+	}
+
+	credential, _ := s.Credential(502)
+	if got := credential.ErrorInfo.String(); !strings.Contains(got, "update your password") {
+		t.Errorf("error info = %q", got)
+	}
+}
+
+func TestInjectedFailuresAreRetried(t *testing.T) {
+	s, mt := startScenario(t)
+
+	accounts, err := mt.GetAccounts()
+	if err != nil {
+		t.Fatalf("GetAccounts: %v", err)
+	}
+	if len(accounts) != 2 {
+		t.Errorf("got %d accounts, want 2", len(accounts))
+	}
+
+	var calls int
+	for _, request := range s.Requests() {
+		if request == "GET /v8/api/accounts.json" {
+			calls++
+		}
+	}
+	if calls != 3 {
+		t.Errorf("accounts.json requested %d times, want 3 (two injected failures)", calls)
+	}
+}
+
+func TestTransactionsPagingAndSince(t *testing.T) {
+	_, mt := startScenario(t)
+
+	page, err := mt.GetTransactions(1001, "2025-01-01", 1, 1)
+	if err != nil {
+		t.Fatalf("GetTransactions: %v", err)
+	}
+	if len(page) != 1 || page[0].ID != 9001 {
+		t.Errorf("page 1 = %+v, want transaction 9001", page)
+	}
+
+	var ids []int
+	for tx, err := range mt.Transactions(context.Background(), 1001, "2025-01-01") {
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, tx.ID)
+	}
+	if len(ids) != 2 {
+		t.Errorf("transactions since 2025-01-01 = %v, want 9001 and 9002", ids)
+	}
+}
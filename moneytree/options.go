@@ -0,0 +1,73 @@
+package moneytree
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// Option configures a Moneytree client in NewClient.
+type Option func(*Moneytree)
+
+// WithBaseURL points API calls (accounts, transactions, ...) at baseURL
+// instead of DefaultBaseURL. The resource server named in token responses is
+// ignored from then on.
+func WithBaseURL(baseURL string) Option {
+	return func(m *Moneytree) {
+		m.baseURL = strings.TrimRight(baseURL, "/")
+		m.baseURLPinned = true
+	}
+}
+
+// WithRegion sends API calls to the resource server of a Moneytree region,
+// e.g. "jp" for jp-api.getmoneytree.com. Without it, the client uses the
+// resource server named in the token response.
+func WithRegion(region string) Option {
+	return func(m *Moneytree) {
+		m.baseURL = RegionBaseURL(region)
+		m.baseURLPinned = true
+	}
+}
+
+// RegionBaseURL returns the API base URL of a Moneytree region.
+func RegionBaseURL(region string) string {
+	return fmt.Sprintf("https://%s-api.getmoneytree.com", strings.ToLower(strings.TrimSpace(region)))
+}
+
+// WithAuthURL points the OAuth token endpoint at authURL instead of
+// DefaultAuthURL.
+func WithAuthURL(authURL string) Option {
+	return func(m *Moneytree) {
+		m.authURL = strings.TrimRight(authURL, "/")
+	}
+}
+
+// WithHTTPClient makes the client send all requests through c, for example
+// to use a proxy or a test transport.
+func WithHTTPClient(c *http.Client) Option {
+	return func(m *Moneytree) {
+		m.httpClient = c
+	}
+}
+
+// WithUserAgent overrides the User-Agent header sent with every request.
+func WithUserAgent(userAgent string) Option {
+	return func(m *Moneytree) {
+		m.userAgent = userAgent
+	}
+}
+
+// WithTokenStore makes the client persist every token it obtains to store,
+// and lets Login pick them up again on the next run.
+func WithTokenStore(store TokenStore) Option {
+	return func(m *Moneytree) {
+		m.tokenStore = store
+	}
+}
+
+// WithRetryPolicy replaces DefaultRetryPolicy for GET requests.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(m *Moneytree) {
+		m.retryPolicy = policy
+	}
+}
@@ -0,0 +1,138 @@
+package moneytree
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Credential statuses reported by Moneytree while an aggregation is still
+// going on. Anything else means the credential has settled, either
+// successfully or not.
+var refreshingStatuses = map[string]bool{
+	"queued":    true,
+	"requested": true,
+	"running":   true,
+	"importing": true,
+	"pending":   true,
+}
+
+const CredentialStatusSuccess = "success"
+
+// refreshClockSkew allows for the local clock running ahead of Moneytree's
+// when comparing StatusSetAt / LastSuccess against the refresh start.
+const refreshClockSkew = time.Minute
+
+type WaitOptions struct {
+	// Since is when the refresh was requested. Credentials only count as done
+	// once their status changed after this. Defaults to the time
+	// WaitForRefresh is called.
+	Since time.Time
+	// Timeout bounds the whole wait. Defaults to 10 minutes.
+	Timeout time.Duration
+	// PollInterval is the delay between GetGuestMeta calls. Defaults to 15
+	// seconds.
+	PollInterval time.Duration
+	// CredentialIDs limits the wait to these credentials. Empty means all.
+	CredentialIDs []int
+}
+
+// RefreshResult is the state of every watched credential when
+// WaitForRefresh returned.
+type RefreshResult struct {
+	Succeeded []MTCredential
+	Failed    []MTCredential
+	// Pending holds credentials that hadn't finished when the timeout hit.
+	Pending []MTCredential
+}
+
+// Done reports whether every credential finished, successfully or not.
+func (r *RefreshResult) Done() bool {
+	return len(r.Pending) == 0
+}
+
+// WaitForRefresh polls GetGuestMeta until every credential has finished
+// refreshing or failed, or until opts.Timeout passes. Hitting the timeout is
+// not an error, the credentials that never finished are in Pending.
+func (m *Moneytree) WaitForRefresh(ctx context.Context, opts WaitOptions) (*RefreshResult, error) {
+	if opts.Since.IsZero() {
+		opts.Since = time.Now()
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Minute
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = 15 * time.Second
+	}
+
+	deadline := time.Now().Add(opts.Timeout)
+	for {
+		guest, err := m.GetGuestMetaContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		result := classifyRefresh(guest.Credentials, opts)
+		if result.Done() || !time.Now().Add(opts.PollInterval).Before(deadline) {
+			return result, nil
+		}
+
+		timer := time.NewTimer(opts.PollInterval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return result, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func classifyRefresh(credentials []MTCredential, opts WaitOptions) *RefreshResult {
+	wanted := make(map[int]bool, len(opts.CredentialIDs))
+	for _, id := range opts.CredentialIDs {
+		wanted[id] = true
+	}
+
+	since := opts.Since.Add(-refreshClockSkew)
+	result := &RefreshResult{}
+	for _, credential := range credentials {
+		if len(wanted) > 0 && !wanted[credential.ID] {
+			continue
+		}
+
+		switch {
+		case refreshingStatuses[credential.Status] || !credentialUpdatedSince(credential, since):
+			result.Pending = append(result.Pending, credential)
+		case credential.Status == CredentialStatusSuccess:
+			result.Succeeded = append(result.Succeeded, credential)
+		default:
+			result.Failed = append(result.Failed, credential)
+		}
+	}
+
+	return result
+}
+
+// credentialUpdatedSince reports whether Moneytree touched the credential's
+// status after t, which is how a finished refresh is told apart from the
+// result of an older one.
+func credentialUpdatedSince(credential MTCredential, t time.Time) bool {
+	for _, value := range []string{credential.StatusSetAt, credential.LastSuccess} {
+		at, err := parseTimestamp(value)
+		if err == nil && at.After(t) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseTimestamp parses the RFC 3339 timestamps Moneytree uses in its
+// responses.
+func parseTimestamp(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("empty timestamp")
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
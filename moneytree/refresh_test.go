@@ -0,0 +1,43 @@
+package moneytree
+
+import (
+	"testing"
+	"time"
+)
+
+func TestClassifyRefresh(t *testing.T) {
+	since := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	before := since.Add(-time.Hour).Format(time.RFC3339)
+	after := since.Add(2 * time.Minute).Format(time.RFC3339)
+
+	credentials := []MTCredential{
+		{ID: 1, Status: "success", StatusSetAt: after, LastSuccess: after},
+		{ID: 2, Status: "running", StatusSetAt: after, LastSuccess: before},
+		{ID: 3, Status: "success", StatusSetAt: before, LastSuccess: before},
+		{ID: 4, Status: "auth_failed", StatusSetAt: after, LastSuccess: before},
+		{ID: 5, Status: "success", StatusSetAt: after},
+	}
+
+	result := classifyRefresh(credentials, WaitOptions{Since: since, CredentialIDs: []int{1, 2, 3, 4}})
+
+	ids := func(creds []MTCredential) []int {
+		var out []int
+		for _, c := range creds {
+			out = append(out, c.ID)
+		}
+		return out
+	}
+
+	if got := ids(result.Succeeded); len(got) != 1 || got[0] != 1 {
+		t.Errorf("Succeeded = %v, want [1]", got)
+	}
+	if got := ids(result.Pending); len(got) != 2 || got[0] != 2 || got[1] != 3 {
+		t.Errorf("Pending = %v, want [2 3]", got)
+	}
+	if got := ids(result.Failed); len(got) != 1 || got[0] != 4 {
+		t.Errorf("Failed = %v, want [4]", got)
+	}
+	if result.Done() {
+		t.Error("Done() = true, want false")
+	}
+}
@@ -0,0 +1,117 @@
+package moneytree
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy controls how idempotent GET requests are retried after network
+// errors, 429 and 5xx responses. Other methods are never retried, since
+// replaying a credential refresh or a token grant isn't safe.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt. 0 disables
+	// retrying.
+	MaxRetries int
+	// BaseDelay is the backoff before the first retry. It doubles on every
+	// further retry, with jitter, up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 4,
+	BaseDelay:  500 * time.Millisecond,
+	MaxDelay:   30 * time.Second,
+}
+
+// backoff returns how long to wait before retry number attempt (starting at
+// 0). A Retry-After sent by the server takes precedence over the computed
+// delay. ok is false when the server asks to wait longer than MaxDelay, in
+// which case retrying isn't worth blocking the run for.
+func (p RetryPolicy) backoff(attempt int, err error) (delay time.Duration, ok bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) && apiErr.RetryAfter > 0 {
+		if p.MaxDelay > 0 && apiErr.RetryAfter > p.MaxDelay {
+			return 0, false
+		}
+		return apiErr.RetryAfter, true
+	}
+
+	delay = p.BaseDelay << attempt
+	if delay <= 0 || (p.MaxDelay > 0 && delay > p.MaxDelay) {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0, true
+	}
+
+	// equal jitter: wait at least half the delay so retries still back off
+	half := delay / 2
+	return half + rand.N(half+1), true
+}
+
+// isRetryable reports whether a failed GET is worth trying again.
+func isRetryable(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.IsRateLimited() || apiErr.IsServerError()
+	}
+
+	// anything that isn't an API error happened on the way to the server
+	return err != nil
+}
+
+// parseRetryAfter reads a Retry-After header given either in seconds or as an
+// HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+
+	return 0
+}
+
+// sendRequest is makeRequest with retries for GET requests according to the
+// client's retry policy.
+func (m *Moneytree) sendRequest(ctx context.Context, method, url string, headers map[string]string, body interface{}) ([]byte, error) {
+	if method != http.MethodGet {
+		return m.makeRequest(ctx, method, url, headers, body)
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := m.makeRequest(ctx, method, url, headers, body)
+		if err == nil || attempt >= m.retryPolicy.MaxRetries || !isRetryable(err) {
+			return resp, err
+		}
+
+		delay, ok := m.retryPolicy.backoff(attempt, err)
+		if !ok {
+			return resp, err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
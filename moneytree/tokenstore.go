@@ -0,0 +1,63 @@
+package moneytree
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"time"
+
+	"github.com/dvcrn/pocketsmith-anapay/internal/atomicfile"
+)
+
+// StoredToken is the token state persisted between runs.
+type StoredToken struct {
+	GuestLogin   string    `json:"guest_login"`
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	// ResourceServer is the API host the tokens were issued for.
+	ResourceServer string `json:"resource_server,omitempty"`
+}
+
+// TokenStore loads and saves tokens so a new process can skip the password
+// grant. Load returns nil, nil when nothing has been stored yet.
+type TokenStore interface {
+	Load() (*StoredToken, error)
+	Save(token *StoredToken) error
+}
+
+// FileTokenStore keeps the token as JSON in a single file that only the
+// current user can read.
+type FileTokenStore struct {
+	Path string
+}
+
+func NewFileTokenStore(path string) *FileTokenStore {
+	return &FileTokenStore{Path: path}
+}
+
+func (s *FileTokenStore) Load() (*StoredToken, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var token StoredToken
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (s *FileTokenStore) Save(token *StoredToken) error {
+	data, err := json.MarshalIndent(token, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return atomicfile.WriteFile(s.Path, data, 0o600)
+}
@@ -0,0 +1,147 @@
+package moneytree
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileTokenStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "token.json")
+	store := NewFileTokenStore(path)
+
+	got, err := store.Load()
+	if err != nil || got != nil {
+		t.Fatalf("Load() on missing file = %v, %v, want nil, nil", got, err)
+	}
+
+	want := &StoredToken{
+		GuestLogin:   "guest@example.com",
+		AccessToken:  "access",
+		RefreshToken: "refresh",
+		ExpiresAt:    time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	if err := store.Save(want); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o600 {
+		t.Errorf("token file permissions = %o, want 600", perm)
+	}
+
+	got, err = store.Load()
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if *got != *want {
+		t.Errorf("Load() = %+v, want %+v", got, want)
+	}
+}
+
+// memoryTokenStore keeps the token in memory. Save fails with saveErr if set.
+type memoryTokenStore struct {
+	token   *StoredToken
+	saveErr error
+}
+
+func (s *memoryTokenStore) Load() (*StoredToken, error) {
+	return s.token, nil
+}
+
+func (s *memoryTokenStore) Save(token *StoredToken) error {
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	s.token = token
+	return nil
+}
+
+func TestLoginFallbackOrder(t *testing.T) {
+	tests := []struct {
+		name        string
+		validTokens []string
+		wantGrants  []string
+	}{
+		{"cached access token", []string{"cached-access", "refreshed", "password"}, nil},
+		{"cached refresh token", []string{"refreshed", "password"}, []string{"refresh_token"}},
+		{"password", []string{"password"}, []string{"refresh_token", "password"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var grants []string
+
+			mux := http.NewServeMux()
+			mux.HandleFunc("/oauth/token", func(w http.ResponseWriter, r *http.Request) {
+				var body map[string]string
+				json.NewDecoder(r.Body).Decode(&body)
+				grants = append(grants, body["grant_type"])
+
+				token := "password"
+				if body["grant_type"] == "refresh_token" {
+					token = "refreshed"
+				}
+				if !slices.Contains(tt.validTokens, token) {
+					w.WriteHeader(http.StatusBadRequest)
+					w.Write([]byte(`{"error":"invalid_grant"}`))
+					return
+				}
+				json.NewEncoder(w).Encode(GetAccessTokenResponse{AccessToken: token, RefreshToken: "next-refresh", ExpiresIn: 7200})
+			})
+			mux.HandleFunc("/v8/api/presenter/guests.json", func(w http.ResponseWriter, r *http.Request) {
+				token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+				if !slices.Contains(tt.validTokens, token) {
+					w.WriteHeader(http.StatusUnauthorized)
+					return
+				}
+				w.Write([]byte(`{"guest":{"id":1}}`))
+			})
+
+			srv := httptest.NewServer(mux)
+			defer srv.Close()
+
+			store := &memoryTokenStore{token: &StoredToken{
+				GuestLogin:   "guest",
+				AccessToken:  "cached-access",
+				RefreshToken: "cached-refresh",
+				ExpiresAt:    time.Now().Add(time.Hour),
+			}}
+			mt := NewClient("key", WithBaseURL(srv.URL), WithAuthURL(srv.URL), WithTokenStore(store))
+
+			if err := mt.Login("guest", "secret"); err != nil {
+				t.Fatalf("Login() error = %v", err)
+			}
+			if !slices.Equal(grants, tt.wantGrants) {
+				t.Errorf("grants = %v, want %v", grants, tt.wantGrants)
+			}
+		})
+	}
+}
+
+func TestLoginSucceedsWhenTokenCannotBeSaved(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"access_token":"token","expires_in":7200}`))
+	}))
+	defer srv.Close()
+
+	store := &memoryTokenStore{saveErr: errors.New("read-only file system")}
+	mt := NewClient("key", WithAuthURL(srv.URL), WithTokenStore(store))
+
+	if err := mt.Login("guest", "secret"); err != nil {
+		t.Fatalf("Login() error = %v", err)
+	}
+	if mt.accessToken != "token" {
+		t.Errorf("access token = %q, want token", mt.accessToken)
+	}
+}
@@ -0,0 +1,85 @@
+package moneytree
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"iter"
+)
+
+// TransactionsPageSize is the page size Transactions requests from Moneytree.
+const TransactionsPageSize = 500
+
+// Transactions iterates over all transactions of an account since the given
+// date (YYYY-MM-DD). Pages are fetched lazily as the caller ranges over the
+// sequence, so breaking out of the loop stops fetching. A failed page is
+// yielded as an error and ends the sequence.
+//
+//	for tx, err := range mt.Transactions(ctx, accountID, "2024-01-01") {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func (m *Moneytree) Transactions(ctx context.Context, accountID int, since string) iter.Seq2[*MTTransaction, error] {
+	return func(yield func(*MTTransaction, error) bool) {
+		for page := 1; ; page++ {
+			txs, err := m.GetTransactionsContext(ctx, accountID, since, page, TransactionsPageSize)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			if len(txs) == 0 {
+				return
+			}
+
+			for _, tx := range txs {
+				if !yield(tx, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// UpdateTransactionDescription is UpdateTransactionDescriptionContext with
+// context.Background().
+func (m *Moneytree) UpdateTransactionDescription(accountID, transactionID int, descriptionGuest string) (*MTTransaction, error) {
+	return m.UpdateTransactionDescriptionContext(context.Background(), accountID, transactionID, descriptionGuest)
+}
+
+// UpdateTransactionDescriptionContext sets the guest description of a
+// transaction, the name the user gave it in the Moneytree app.
+func (m *Moneytree) UpdateTransactionDescriptionContext(ctx context.Context, accountID, transactionID int, descriptionGuest string) (*MTTransaction, error) {
+	url := fmt.Sprintf("%s/v8/api/accounts/%d/transactions/%d.json", m.apiBaseURL(), accountID, transactionID)
+	headers := map[string]string{
+		"Accept-Language": "en_AU",
+		"locale":          "en_AU",
+		"X-Api-Key":       m.apiKey,
+		"X-Api-Version":   "20180814",
+		"Accept":          "application/json",
+		"User-Agent":      m.userAgentOr(appUserAgent),
+		"Connection":      "Keep-Alive",
+		"Content-Type":    "application/json",
+	}
+
+	body := map[string]map[string]string{
+		"transaction": {
+			"description_guest": descriptionGuest,
+		},
+	}
+
+	resp, err := m.authorizedRequest(ctx, "PUT", url, headers, body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Transaction *MTTransaction `json:"transaction"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return nil, err
+	}
+	return result.Transaction, nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/dvcrn/pocketsmith-anapay/internal/accountmatch"
+	"github.com/dvcrn/pocketsmith-anapay/internal/accountname"
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+	"github.com/dvcrn/pocketsmith-go"
+)
+
+// accountName is the Pocketsmith title of a Moneytree account, along with
+// the title the built-in naming gives it, so accounts created before a
+// naming template was configured are still recognized. moneytreeID is the
+// Moneytree account the name belongs to, 0 for accounts derived from one.
+//
+// number, currency and suffix identify the account independently of any
+// naming template: its account number, and for accounts derived from it, what
+// follows its name.
+type accountName struct {
+	moneytreeID int
+	institution string
+	base        string
+	display     string
+	legacyBase  string
+	number      string
+	currency    string
+	suffix      string
+}
+
+// newAccountName names an account with tmpl, or with the built-in
+// "Institution - Name (Number)" scheme when tmpl is nil.
+func newAccountName(account moneytree.MTAccount, institutionName string, tmpl *accountname.Template) (accountName, error) {
+	name := accountName{
+		moneytreeID: account.ID,
+		institution: institutionName,
+		legacyBase:  legacyBaseName(account),
+		number:      account.InstitutionAccountNumber,
+		currency:    account.Currency,
+	}
+	name.base = name.legacyBase
+	name.display = accountmatch.BuildDisplayAccountName(institutionName, name.base)
+
+	if tmpl == nil {
+		return name, nil
+	}
+
+	data := accountname.Data{
+		Institution: institutionName,
+		Name:        account.InstitutionAccountName,
+		Nickname:    account.Nickname,
+		Number:      accountname.MaskNumber(account.InstitutionAccountNumber),
+		Currency:    account.Currency,
+		AccountType: string(account.AccountType),
+		SubType:     account.SubType,
+	}
+	if account.BranchName != nil {
+		data.BranchName = *account.BranchName
+	}
+
+	rendered, err := tmpl.Execute(data)
+	if err != nil {
+		return name, fmt.Errorf("naming account %d: %w", account.ID, err)
+	}
+	name.base = rendered
+	name.display = rendered
+
+	return name, nil
+}
+
+// legacyBaseName is the account name the sync has always used, without the
+// institution.
+func legacyBaseName(account moneytree.MTAccount) string {
+	if account.AccountType == moneytree.MTAccountTypeCash {
+		return cashWalletName(account)
+	}
+
+	baseName := fmt.Sprintf("%s (%s)", account.InstitutionAccountName, account.InstitutionAccountNumber)
+	if account.Currency != "JPY" {
+		if !strings.Contains(baseName, account.Currency) || (len(account.Currency) >= 2 && !strings.Contains(baseName, account.Currency[0:2])) {
+			baseName = fmt.Sprintf("%s (%s) (%s)", account.InstitutionAccountName, account.Currency, account.InstitutionAccountNumber)
+		}
+	}
+
+	return baseName
+}
+
+// child names an account that belongs to this one, like a single holding of
+// a stock account.
+func (n accountName) child(label string) accountName {
+	return accountName{
+		institution: n.institution,
+		base:        fmt.Sprintf("%s - %s", n.base, label),
+		display:     fmt.Sprintf("%s - %s", n.display, label),
+		legacyBase:  fmt.Sprintf("%s - %s", n.legacyBase, label),
+		number:      n.number,
+		suffix:      fmt.Sprintf("%s - %s", n.suffix, label),
+	}
+}
+
+// candidates are the titles the account may have in Pocketsmith, current
+// naming first. Titles marked as closed are tried last.
+func (n accountName) candidates() []accountmatch.Candidate {
+	candidates := []accountmatch.Candidate{{BaseName: n.base, DisplayName: n.display}}
+	if n.legacyBase != n.base {
+		candidates = append(candidates, accountmatch.Candidate{
+			BaseName:    n.legacyBase,
+			DisplayName: accountmatch.BuildDisplayAccountName(n.institution, n.legacyBase),
+		})
+	}
+
+	for _, candidate := range candidates {
+		candidates = append(candidates, accountmatch.Candidate{
+			BaseName:    candidate.BaseName + closedMarker,
+			DisplayName: candidate.DisplayName + closedMarker,
+		})
+	}
+
+	return candidates
+}
+
+// isGeneratedTitle reports whether title is one the sync gives the account,
+// as opposed to one chosen in Pocketsmith.
+func isGeneratedTitle(title string, name accountName) bool {
+	for _, candidate := range name.candidates() {
+		if title == candidate.DisplayName {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchAccount finds the Pocketsmith account of a Moneytree account, also
+// when it carries an older title or was renamed with closedMarker before.
+// Titles from an earlier naming template are recognized by the account
+// number in them.
+func matchAccount(accounts []*pocketsmith.Account, name accountName) (*pocketsmith.Account, error) {
+	account, err := accountmatch.FindMatchingAccountByCandidates(accounts, name.institution, name.candidates())
+	if err != pocketsmith.ErrNotFound {
+		return account, err
+	}
+
+	return accountmatch.FindMatchingAccountByNumber(accounts, name.institution, name.currency, name.number, name.suffix)
+}
+
+func (n accountName) String() string {
+	return n.display
+}
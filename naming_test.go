@@ -0,0 +1,66 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dvcrn/pocketsmith-anapay/internal/accountname"
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+	"github.com/dvcrn/pocketsmith-go"
+)
+
+func TestMatchAccountAfterTemplateChange(t *testing.T) {
+	account := moneytree.MTAccount{ID: 42, InstitutionAccountName: "普通預金", Nickname: "Main", InstitutionAccountNumber: "1234567", Currency: "JPY"}
+
+	before, err := accountname.Parse("{{.Nickname}} {{.Number}}")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+	after, err := accountname.Parse("{{.Institution}}: {{.Name}} {{.Number}}")
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	oldName, err := newAccountName(account, "Rakuten Bank", before)
+	if err != nil {
+		t.Fatalf("newAccountName() error = %v", err)
+	}
+	newName, err := newAccountName(account, "Rakuten Bank", after)
+	if err != nil {
+		t.Fatalf("newAccountName() error = %v", err)
+	}
+
+	rakuten := pocketsmith.TransactionAccount{Institution: pocketsmith.Institution{Title: "Rakuten Bank"}}
+	accounts := []*pocketsmith.Account{
+		{ID: 1, Title: oldName.display, CurrencyCode: "jpy", PrimaryTransactionAccount: rakuten},
+		{ID: 2, Title: oldName.child("VTI").display, CurrencyCode: "usd", PrimaryTransactionAccount: rakuten},
+	}
+
+	for name, want := range map[accountName]int{newName: 1, newName.child("VTI"): 2} {
+		got, err := matchAccount(accounts, name)
+		if err != nil {
+			t.Fatalf("matchAccount(%s) error = %v", name, err)
+		}
+		if got.ID != want {
+			t.Errorf("matchAccount(%s) = account %d (%q), want %d", name, got.ID, got.Title, want)
+		}
+	}
+}
+
+func TestLegacyBaseNameCurrency(t *testing.T) {
+	tests := []struct {
+		currency string
+		want     string
+	}{
+		{"JPY", "普通預金 (1234567)"},
+		{"USD", "普通預金 (USD) (1234567)"},
+		{"", "普通預金 (1234567)"},
+		{"U", "普通預金 (U) (1234567)"},
+	}
+
+	for _, tt := range tests {
+		account := moneytree.MTAccount{InstitutionAccountName: "普通預金", InstitutionAccountNumber: "1234567", Currency: tt.currency}
+		if got := legacyBaseName(account); got != tt.want {
+			t.Errorf("legacyBaseName() with currency %q = %q, want %q", tt.currency, got, tt.want)
+		}
+	}
+}
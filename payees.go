@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dvcrn/pocketsmith-anapay/internal/syncstate"
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+	sanitizier "github.com/dvcrn/pocketsmith-anapay/sanitizer"
+	"github.com/dvcrn/pocketsmith-go"
+	"github.com/getsentry/sentry-go"
+)
+
+const (
+	payeeWritebackOff    = ""
+	payeeWritebackDryRun = "dry-run"
+	payeeWritebackApply  = "apply"
+)
+
+// payeeFromName turns a Moneytree description into the payee pushed to
+// Pocketsmith.
+func payeeFromName(name string) string {
+	payee := sanitizier.Sanitize(strings.TrimSpace(name))
+	if payee == "" {
+		payee = "Unknown"
+	}
+
+	return payee
+}
+
+// pushedPayee recovers the payee a transaction was originally pushed with
+// from its memo, which holds the Moneytree description followed by the
+// mtid= marker.
+func pushedPayee(memo string) (string, bool) {
+	i := strings.LastIndex(memo, "mtid=")
+	if i < 0 {
+		return "", false
+	}
+
+	return payeeFromName(memo[:i]), true
+}
+
+// editedPayee reports whether the payee of a pushed transaction was changed
+// in Pocketsmith, and the raw ID of the Moneytree transaction it belongs to.
+func editedPayee(psTx *pocketsmith.DetailedTransaction) (int, bool) {
+	pushed, ok := pushedPayee(psTx.Memo)
+	if !ok || psTx.Payee == "" || psTx.Payee == pushed {
+		return 0, false
+	}
+
+	fields := strings.Fields(psTx.Memo[strings.LastIndex(psTx.Memo, "mtid=")+len("mtid="):])
+	if len(fields) == 0 {
+		return 0, false
+	}
+
+	rawID, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, false
+	}
+
+	return rawID, true
+}
+
+// descriptionUpdater is the part of the Moneytree client that renames
+// transactions.
+type descriptionUpdater interface {
+	UpdateTransactionDescriptionContext(ctx context.Context, accountID, transactionID int, descriptionGuest string) (*moneytree.MTTransaction, error)
+}
+
+// writeBackPayee copies a payee that was edited in Pocketsmith back to the
+// guest description of the Moneytree transaction. In dry-run mode the change
+// is only printed.
+func writeBackPayee(ctx context.Context, mt descriptionUpdater, mode string, tx *moneytree.MTTransaction, psTx *pocketsmith.DetailedTransaction) error {
+	if mode == payeeWritebackOff {
+		return nil
+	}
+
+	pushed, ok := pushedPayee(psTx.Memo)
+	if !ok || psTx.Payee == "" || psTx.Payee == pushed {
+		return nil
+	}
+
+	// already written back on an earlier run
+	if tx.DescriptionGuest != "" && payeeFromName(tx.DescriptionGuest) == psTx.Payee {
+		return nil
+	}
+
+	if mode == payeeWritebackDryRun {
+		fmt.Printf("[dry-run] Would rename Moneytree transaction %d: %q -> %q\n", tx.ID, pushed, psTx.Payee)
+		return nil
+	}
+
+	if _, err := mt.UpdateTransactionDescriptionContext(ctx, tx.AccountID, tx.ID, psTx.Payee); err != nil {
+		return fmt.Errorf("renaming Moneytree transaction %d: %w", tx.ID, err)
+	}
+
+	fmt.Printf("Renamed Moneytree transaction %d: %q -> %q\n", tx.ID, pushed, psTx.Payee)
+	return nil
+}
+
+// writeBackPayees looks through the Pocketsmith transactions of an account
+// for payees edited after they were pushed and writes them back to Moneytree.
+// With a state file only transactions updated since the last check are
+// listed, otherwise the whole account is.
+func writeBackPayees(ctx context.Context, ps transactionLister, mt *moneytree.Moneytree, mode string, state *syncstate.State, accountID, transactionAccountID int) {
+	startedAt := time.Now()
+
+	var opts []pocketsmith.ListTransactionsOption
+	if state != nil {
+		if checkedAt := state.Account(accountID).PayeesCheckedAt; checkedAt != "" {
+			opts = append(opts, pocketsmith.WithUpdatedSince(checkedAt))
+		}
+	}
+
+	edited := map[int]*pocketsmith.DetailedTransaction{}
+	since := ""
+	for psTx, err := range pocketsmithTransactions(ps, transactionAccountID, opts...) {
+		if err != nil {
+			sentry.CaptureException(err)
+			fmt.Println("Error listing Pocketsmith transactions for payee write-back: ", err)
+			return
+		}
+
+		rawID, ok := editedPayee(psTx)
+		if !ok {
+			continue
+		}
+		edited[rawID] = psTx
+		if since == "" || psTx.Date < since {
+			since = psTx.Date
+		}
+	}
+
+	failed := false
+	if len(edited) > 0 {
+		for tx, err := range mt.Transactions(ctx, accountID, since) {
+			if err != nil {
+				sentry.CaptureException(err)
+				fmt.Println("Error getting transactions for payee write-back: ", err)
+				return
+			}
+
+			psTx, ok := edited[tx.RawTransactionID]
+			if !ok {
+				continue
+			}
+			if err := writeBackPayee(ctx, mt, mode, tx, psTx); err != nil {
+				sentry.CaptureException(err)
+				fmt.Println("Error writing back payee: ", err)
+				failed = true
+			}
+		}
+	}
+
+	// a dry run leaves the edits to be found again by the next run
+	if state == nil || failed || mode != payeeWritebackApply {
+		return
+	}
+
+	state.Account(accountID).PayeesCheckedAt = startedAt.UTC().Format(time.RFC3339)
+	if err := state.Save(); err != nil {
+		sentry.CaptureException(err)
+		fmt.Println("Error saving sync state: ", err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+	"github.com/dvcrn/pocketsmith-go"
+)
+
+func TestPushedPayee(t *testing.T) {
+	tests := []struct {
+		memo   string
+		want   string
+		wantOK bool
+	}{
+		{"ｾﾌﾞﾝｲﾚﾌﾞﾝ mtid=123 kind=expense(moneytree)", payeeFromName("ｾﾌﾞﾝｲﾚﾌﾞﾝ"), true},
+		{"mtid=123", "Unknown", true},
+		{"added by hand", "", false},
+	}
+
+	for _, tt := range tests {
+		got, ok := pushedPayee(tt.memo)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("pushedPayee(%q) = %q, %t, want %q, %t", tt.memo, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestEditedPayee(t *testing.T) {
+	tests := []struct {
+		name   string
+		psTx   pocketsmith.DetailedTransaction
+		want   int
+		wantOK bool
+	}{
+		{"edited", pocketsmith.DetailedTransaction{Payee: "7-Eleven", Memo: "ｾﾌﾞﾝｲﾚﾌﾞﾝ mtid=123 claim=9 kind=expense(moneytree)"}, 123, true},
+		{"unchanged", pocketsmith.DetailedTransaction{Payee: payeeFromName("ｾﾌﾞﾝｲﾚﾌﾞﾝ"), Memo: "ｾﾌﾞﾝｲﾚﾌﾞﾝ mtid=123"}, 0, false},
+		{"not pushed", pocketsmith.DetailedTransaction{Payee: "Rent", Memo: "paid in cash"}, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := editedPayee(&tt.psTx)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("editedPayee() = %d, %t, want %d, %t", got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+type fakeDescriptionUpdater struct {
+	calls []string
+	err   error
+}
+
+func (f *fakeDescriptionUpdater) UpdateTransactionDescriptionContext(ctx context.Context, accountID, transactionID int, descriptionGuest string) (*moneytree.MTTransaction, error) {
+	f.calls = append(f.calls, descriptionGuest)
+	return &moneytree.MTTransaction{ID: transactionID, DescriptionGuest: descriptionGuest}, f.err
+}
+
+func TestWriteBackPayee(t *testing.T) {
+	psTx := &pocketsmith.DetailedTransaction{Payee: "7-Eleven", Memo: "ｾﾌﾞﾝｲﾚﾌﾞﾝ mtid=123"}
+
+	tests := []struct {
+		name      string
+		mode      string
+		tx        moneytree.MTTransaction
+		updateErr error
+		wantCalls int
+		wantErr   bool
+	}{
+		{"off", payeeWritebackOff, moneytree.MTTransaction{ID: 1}, nil, 0, false},
+		{"dry run", payeeWritebackDryRun, moneytree.MTTransaction{ID: 1}, nil, 0, false},
+		{"apply", payeeWritebackApply, moneytree.MTTransaction{ID: 1}, nil, 1, false},
+		{"already written back", payeeWritebackApply, moneytree.MTTransaction{ID: 1, DescriptionGuest: "7-Eleven"}, nil, 0, false},
+		{"update fails", payeeWritebackApply, moneytree.MTTransaction{ID: 1}, errors.New("boom"), 1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mt := &fakeDescriptionUpdater{err: tt.updateErr}
+			err := writeBackPayee(context.Background(), mt, tt.mode, &tt.tx, psTx)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("writeBackPayee() error = %v, want error %t", err, tt.wantErr)
+			}
+			if len(mt.calls) != tt.wantCalls {
+				t.Errorf("updates = %v, want %d", mt.calls, tt.wantCalls)
+			}
+			if len(mt.calls) > 0 && mt.calls[0] != "7-Eleven" {
+				t.Errorf("description = %q, want 7-Eleven", mt.calls[0])
+			}
+		})
+	}
+}
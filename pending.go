@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dvcrn/pocketsmith-anapay/internal/pocketsmithx"
+	"github.com/dvcrn/pocketsmith-anapay/internal/syncstate"
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+	"github.com/dvcrn/pocketsmith-go"
+	"github.com/getsentry/sentry-go"
+)
+
+// claimMarker tags Pocketsmith transactions with the Moneytree claim of a
+// card transaction, so the posted transaction can find the one pushed while
+// it was still pending.
+func claimMarker(claimID int) string {
+	return fmt.Sprintf("claim=%d", claimID)
+}
+
+// dropSupersededClaims removes transactions of a claim that were replaced by
+// a later transaction of the same claim, i.e. pending authorizations whose
+// posted transaction is already in txs.
+func dropSupersededClaims(txs []*moneytree.MTTransaction) []*moneytree.MTTransaction {
+	latest := map[int]int{}
+	for _, tx := range txs {
+		if tx.ClaimID != 0 && tx.ID > latest[tx.ClaimID] {
+			latest[tx.ClaimID] = tx.ID
+		}
+	}
+
+	return slices.DeleteFunc(txs, func(tx *moneytree.MTTransaction) bool {
+		return tx.ClaimID != 0 && tx.ID != latest[tx.ClaimID]
+	})
+}
+
+// findClaimTransaction looks for the Pocketsmith transaction pushed for an
+// earlier transaction of the same claim. Posting can move the date, so
+// everything within window of tx is searched, page by page.
+func findClaimTransaction(ps transactionLister, psAccountID int, tx *moneytree.MTTransaction, window time.Duration) (*pocketsmith.DetailedTransaction, error) {
+	startDate := tx.Date.Add(-window).Format("2006-01-02")
+	endDate := tx.Date.Add(window).Format("2006-01-02")
+
+	marker := claimMarker(tx.ClaimID)
+	for candidate, err := range pocketsmithTransactions(ps, psAccountID, pocketsmith.WithStartDate(startDate), pocketsmith.WithEndDate(endDate)) {
+		if err != nil {
+			return nil, err
+		}
+		if slices.Contains(strings.Fields(candidate.Memo), marker) {
+			return candidate, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// expirePendingClaims deletes Pocketsmith transactions of card authorizations
+// that never posted: claims older than window whose transaction is gone from
+// Moneytree. Claims whose transaction is still there have evidently posted
+// under the same ID and are no longer tracked.
+func expirePendingClaims(ctx context.Context, mt *moneytree.Moneytree, psx *pocketsmithx.Client, state *syncstate.State, accountID int, window time.Duration) {
+	overdue := state.OverdueClaims(accountID, time.Now().Add(-window))
+	if len(overdue) == 0 {
+		return
+	}
+
+	since := ""
+	for _, claim := range overdue {
+		if since == "" || claim.Date < since {
+			since = claim.Date
+		}
+	}
+
+	present := map[int]bool{}
+	for tx, err := range mt.Transactions(ctx, accountID, since) {
+		if err != nil {
+			sentry.CaptureException(err)
+			fmt.Println("Error checking pending transactions, will retry next run: ", err)
+			return
+		}
+		present[tx.RawTransactionID] = true
+	}
+
+	for claimID, claim := range overdue {
+		if present[claim.RawTransactionID] {
+			state.ResolveClaim(claimID)
+			continue
+		}
+
+		fmt.Printf("Pending transaction %d from %s never posted, deleting it from Pocketsmith\n", claim.RawTransactionID, claim.Date)
+		if err := psx.DeleteTransaction(claim.PocketsmithID); err != nil {
+			sentry.CaptureException(err)
+			fmt.Println("Error deleting pending transaction: ", err)
+			continue
+		}
+
+		state.ResolveClaim(claimID)
+	}
+}
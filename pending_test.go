@@ -0,0 +1,50 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+	"github.com/dvcrn/pocketsmith-go"
+)
+
+func TestDropSupersededClaims(t *testing.T) {
+	txs := []*moneytree.MTTransaction{
+		{ID: 10, ClaimID: 7},
+		{ID: 11},
+		{ID: 12, ClaimID: 7},
+		{ID: 13, ClaimID: 8},
+		{ID: 14},
+	}
+
+	var ids []int
+	for _, tx := range dropSupersededClaims(txs) {
+		ids = append(ids, tx.ID)
+	}
+	if want := []int{11, 12, 13, 14}; !slices.Equal(ids, want) {
+		t.Errorf("dropSupersededClaims() kept %v, want %v", ids, want)
+	}
+}
+
+func TestFindClaimTransactionSearchesAllPages(t *testing.T) {
+	ps := &fakeTransactionLister{pages: [][]*pocketsmith.DetailedTransaction{
+		{{ID: 1, Memo: "AMAZON mtid=100 claim=70"}, {ID: 2, Memo: "AMAZON mtid=101"}},
+		{{ID: 3, Memo: "AMAZON mtid=102 claim=7 kind=expense(moneytree)"}},
+	}}
+	tx := &moneytree.MTTransaction{ID: 200, ClaimID: 7, Date: time.Date(2025, 1, 10, 0, 0, 0, 0, time.UTC)}
+
+	found, err := findClaimTransaction(ps, 1, tx, 14*24*time.Hour)
+	if err != nil {
+		t.Fatalf("findClaimTransaction() error = %v", err)
+	}
+	if found == nil || found.ID != 3 {
+		t.Errorf("findClaimTransaction() = %+v, want transaction 3 from the second page", found)
+	}
+
+	ps.calls = 0
+	tx.ClaimID = 8
+	if found, err := findClaimTransaction(ps, 1, tx, 14*24*time.Hour); err != nil || found != nil {
+		t.Errorf("findClaimTransaction() of an unknown claim = %+v, %v, want nil, nil", found, err)
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dvcrn/pocketsmith-anapay/internal/syncstate"
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+	"github.com/dvcrn/pocketsmith-go"
+)
+
+// defaultPointRate is what a point is worth when no rate matches its program.
+const defaultPointRate = 1.0
+
+// pointRate is the value of one point of a program in the base currency.
+type pointRate struct {
+	program string
+	rate    float64
+}
+
+// parsePointRates parses a comma-separated list of program=rate pairs, e.g.
+// "ANA=1.5,JAL=1.5,*=1". A program of * sets the rate for everything else.
+func parsePointRates(value string) ([]pointRate, error) {
+	var rates []pointRate
+	for _, item := range splitList(value) {
+		program, rateValue, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid point rate %q, use program=rate", item)
+		}
+
+		rate, err := strconv.ParseFloat(strings.TrimSpace(rateValue), 64)
+		if err != nil || rate < 0 {
+			return nil, fmt.Errorf("invalid point rate %q, the rate must be a number of at least 0", item)
+		}
+
+		rates = append(rates, pointRate{program: strings.TrimSpace(program), rate: rate})
+	}
+
+	// the most specific program wins when several match
+	sort.SliceStable(rates, func(i, j int) bool {
+		return len(rates[i].program) > len(rates[j].program)
+	})
+
+	return rates, nil
+}
+
+// pointRateFor returns the rate of the first program that is part of the
+// institution or account name, ignoring case.
+func pointRateFor(rates []pointRate, institutionName string, account moneytree.MTAccount) float64 {
+	names := strings.ToLower(strings.Join([]string{institutionName, account.InstitutionAccountName, account.Nickname}, "\x00"))
+
+	fallback := defaultPointRate
+	for _, r := range rates {
+		if r.program == "*" {
+			fallback = r.rate
+			continue
+		}
+		if strings.Contains(names, strings.ToLower(r.program)) {
+			return r.rate
+		}
+	}
+
+	return fallback
+}
+
+// syncPointAccount values a point program as an other-asset account in the
+// base currency. Only the balance is synced, accruals and redemptions are in
+// points and would not add up to the converted value.
+func syncPointAccount(ps *pocketsmith.Client, userID int, state *syncstate.State, name accountName, baseCurrency string, account moneytree.MTAccount, rates []pointRate) {
+	rate := pointRateFor(rates, name.institution, account)
+	value := account.CurrentBalance * rate
+
+	fmt.Printf("Points %s: %.0f points at %.4f %s = %.2f %s\n", name, account.CurrentBalance, rate, baseCurrency, value, baseCurrency)
+	setAccountValue(ps, userID, state, name, moneytree.MTAccountTypePoint, baseCurrency, value, time.Now().Format("2006-01-02"))
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+)
+
+func TestPointRates(t *testing.T) {
+	tests := []struct {
+		name        string
+		rates       string
+		institution string
+		account     moneytree.MTAccount
+		want        float64
+		wantErr     bool
+	}{
+		{name: "no rates", institution: "ANA Mileage Club", want: defaultPointRate},
+		{name: "program in the institution", rates: "ANA=1.5,JAL=2", institution: "ANA Mileage Club", want: 1.5},
+		{name: "program in the nickname, ignoring case", rates: "jal=2", institution: "Airline", account: moneytree.MTAccount{Nickname: "JAL Mileage Bank"}, want: 2},
+		{name: "star is the fallback", rates: "*=0.5,ANA=1.5", institution: "Rakuten Point", want: 0.5},
+		{name: "star doesn't override a match", rates: "*=0.5,ANA=1.5", institution: "ANA Mileage Club", want: 1.5},
+		{name: "most specific program wins", rates: "ANA=1.5,ANA SKY=1.2", institution: "ANA SKY Coin", want: 1.2},
+		{name: "spaces are trimmed", rates: " ANA = 1.5 , ", institution: "ANA Mileage Club", want: 1.5},
+		{name: "missing rate", rates: "ANA", wantErr: true},
+		{name: "rate not a number", rates: "ANA=lots", wantErr: true},
+		{name: "negative rate", rates: "ANA=-1", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rates, err := parsePointRates(tt.rates)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parsePointRates(%q) error = %v, wantErr %v", tt.rates, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if got := pointRateFor(rates, tt.institution, tt.account); got != tt.want {
+				t.Errorf("pointRateFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
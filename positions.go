@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dvcrn/pocketsmith-anapay/internal/syncstate"
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+	"github.com/dvcrn/pocketsmith-go"
+	"github.com/getsentry/sentry-go"
+)
+
+// positionLabel tells the holdings of a stock account apart in their account
+// names, e.g. "SBI Securities (1234567) - VTI".
+func positionLabel(ticker, name string) string {
+	if ticker == "" {
+		return name
+	}
+
+	return ticker
+}
+
+// syncPositions mirrors each holding of a Moneytree stock account into its own
+// Pocketsmith stocks account and sets its balance to the current market value.
+// Holdings that disappeared since the last run are valued at 0: the ones the
+// state file remembers, or without one, the Pocketsmith accounts named like
+// holdings of this account. When a state file is configured, every run's
+// valuation is appended to its history.
+func syncPositions(ctx context.Context, ps *pocketsmith.Client, mt *moneytree.Moneytree, userID int, state *syncstate.State, account moneytree.MTAccount, accountName accountName) {
+	positions, err := mt.GetPositionsContext(ctx, strconv.Itoa(account.ID))
+	if err != nil {
+		sentry.CaptureException(err)
+		fmt.Println("Error getting positions: ", err)
+		return
+	}
+
+	today := time.Now().Format("2006-01-02")
+	held := map[string]bool{}
+	var snapshots []syncstate.PositionSnapshot
+	for _, position := range positions {
+		currency := position.Currency
+		if currency == "" {
+			currency = account.Currency
+		}
+
+		snapshot := syncstate.PositionSnapshot{
+			Date:        today,
+			Ticker:      position.Ticker,
+			Name:        position.NameClean,
+			Currency:    currency,
+			Quantity:    position.Quantity,
+			MarketValue: position.MarketValue,
+			CostBasis:   position.CostBasis,
+			Profit:      position.Profit,
+		}
+		if snapshot.Name == "" {
+			snapshot.Name = position.NameRaw
+		}
+
+		snapshots = append(snapshots, snapshot)
+		positionName := accountName.child(positionLabel(snapshot.Ticker, snapshot.Name))
+		held[positionName.display] = true
+
+		fmt.Printf("Position %s %s: %.4f units, market value %.2f %s (profit %.2f)\n", snapshot.Ticker, snapshot.Name, snapshot.Quantity, snapshot.MarketValue, currency, snapshot.Profit)
+		setAccountValue(ps, userID, state, positionName, moneytree.MTAccountTypeStock, currency, snapshot.MarketValue, today)
+	}
+
+	if state == nil {
+		zeroSoldPositionAccounts(ps, userID, accountName, held, today)
+		return
+	}
+
+	// holdings we valued before but Moneytree no longer lists were sold
+	for _, previous := range soldPositions(state.LatestPositions(account.ID), accountName, held) {
+		positionName := accountName.child(positionLabel(previous.Ticker, previous.Name))
+		fmt.Printf("Position %s %s is gone, setting its value to 0\n", previous.Ticker, previous.Name)
+		setAccountValue(ps, userID, state, positionName, moneytree.MTAccountTypeStock, previous.Currency, 0, today)
+		snapshots = append(snapshots, syncstate.PositionSnapshot{
+			Date:     today,
+			Ticker:   previous.Ticker,
+			Name:     previous.Name,
+			Currency: previous.Currency,
+		})
+	}
+
+	state.RecordPositions(account.ID, snapshots)
+	if err := state.Save(); err != nil {
+		sentry.CaptureException(err)
+		fmt.Println("Error saving position history: ", err)
+	}
+}
+
+// soldPositions returns the holdings of previous that are no longer held and
+// weren't valued at 0 yet.
+func soldPositions(previous []syncstate.PositionSnapshot, accountName accountName, held map[string]bool) []syncstate.PositionSnapshot {
+	var sold []syncstate.PositionSnapshot
+	for _, snapshot := range previous {
+		positionName := accountName.child(positionLabel(snapshot.Ticker, snapshot.Name))
+		if held[positionName.display] || snapshot.Quantity == 0 {
+			continue
+		}
+
+		sold = append(sold, snapshot)
+	}
+
+	return sold
+}
+
+// soldPositionAccounts returns the Pocketsmith accounts named like holdings of
+// the stock account that aren't held anymore but still have a value.
+func soldPositionAccounts(accounts []*pocketsmith.Account, accountName accountName, held map[string]bool) []*pocketsmith.Account {
+	prefix := accountName.display + " - "
+
+	var sold []*pocketsmith.Account
+	for _, account := range accounts {
+		if !strings.HasPrefix(account.Title, prefix) || held[account.Title] || math.Abs(account.CurrentBalance) < 0.005 {
+			continue
+		}
+
+		sold = append(sold, account)
+	}
+
+	return sold
+}
+
+// zeroSoldPositionAccounts values the Pocketsmith accounts of sold holdings
+// at 0 when there is no state file to remember them in.
+func zeroSoldPositionAccounts(ps *pocketsmith.Client, userID int, accountName accountName, held map[string]bool, today string) {
+	accounts, err := ps.ListAccounts(userID)
+	if err != nil {
+		sentry.CaptureException(err)
+		fmt.Println("Error listing accounts: ", err)
+		return
+	}
+
+	for _, account := range soldPositionAccounts(accounts, accountName, held) {
+		fmt.Printf("Position %s is gone, setting its value to 0\n", account.Title)
+		_, err := ps.UpdateTransactionAccount(account.PrimaryTransactionAccount.ID, account.PrimaryTransactionAccount.Institution.ID, 0, today)
+		if err != nil {
+			sentry.CaptureException(err)
+			fmt.Println("Error updating account value: ", err)
+		}
+	}
+}
+
+// setAccountValue values a Pocketsmith account that only tracks a balance,
+// like a holding or a point program, at value by moving its starting balance
+// to today.
+func setAccountValue(ps *pocketsmith.Client, userID int, state *syncstate.State, name accountName, accountType moneytree.MTAccountType, currency string, value float64, today string) {
+	psAccount, err := findOrCreateAccount(ps, userID, state, name, accountType, currency)
+	if err != nil {
+		sentry.CaptureException(err)
+		fmt.Println("Error creating account: ", err)
+		return
+	}
+
+	if math.Abs(psAccount.CurrentBalance-value) < 0.005 {
+		return
+	}
+
+	_, err = ps.UpdateTransactionAccount(psAccount.PrimaryTransactionAccount.ID, psAccount.PrimaryTransactionAccount.Institution.ID, value, today)
+	if err != nil {
+		sentry.CaptureException(err)
+		fmt.Println("Error updating account value: ", err)
+	}
+}
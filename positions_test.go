@@ -0,0 +1,45 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dvcrn/pocketsmith-anapay/internal/syncstate"
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+	"github.com/dvcrn/pocketsmith-go"
+)
+
+func TestSoldPositions(t *testing.T) {
+	name, err := newAccountName(moneytree.MTAccount{ID: 1, InstitutionAccountName: "Stocks", InstitutionAccountNumber: "1234567", Currency: "JPY"}, "SBI Securities", nil)
+	if err != nil {
+		t.Fatalf("newAccountName() error = %v", err)
+	}
+	held := map[string]bool{name.child("VTI").display: true}
+
+	t.Run("from the state file", func(t *testing.T) {
+		previous := []syncstate.PositionSnapshot{
+			{Ticker: "VTI", Quantity: 10},
+			{Ticker: "VOO", Quantity: 5},
+			{Ticker: "QQQ", Quantity: 0},
+		}
+
+		sold := soldPositions(previous, name, held)
+		if len(sold) != 1 || sold[0].Ticker != "VOO" {
+			t.Errorf("soldPositions() = %+v, want only VOO", sold)
+		}
+	})
+
+	t.Run("from Pocketsmith account titles", func(t *testing.T) {
+		accounts := []*pocketsmith.Account{
+			{ID: 1, Title: name.display, CurrentBalance: 1000},
+			{ID: 2, Title: name.child("VTI").display, CurrentBalance: 500},
+			{ID: 3, Title: name.child("VOO").display, CurrentBalance: 300},
+			{ID: 4, Title: name.child("QQQ").display, CurrentBalance: 0},
+			{ID: 5, Title: "Other - VOO", CurrentBalance: 300},
+		}
+
+		sold := soldPositionAccounts(accounts, name, held)
+		if len(sold) != 1 || sold[0].ID != 3 {
+			t.Errorf("soldPositionAccounts() = %+v, want only account 3", sold)
+		}
+	})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"iter"
+	"slices"
+	"strings"
+
+	"github.com/dvcrn/pocketsmith-go"
+)
+
+// transactionLister is the part of the Pocketsmith client that lists
+// transactions, so paging can be tested without the API.
+type transactionLister interface {
+	ListTransactions(accountID int, opts ...pocketsmith.ListTransactionsOption) ([]*pocketsmith.DetailedTransaction, error)
+}
+
+// pocketsmithTransactions iterates over all transactions of a Pocketsmith
+// transaction account matching opts. Pocketsmith only returns one page per
+// request, so pages are fetched lazily until one comes back empty. A failed
+// page is yielded as an error and ends the sequence.
+func pocketsmithTransactions(ps transactionLister, transactionAccountID int, opts ...pocketsmith.ListTransactionsOption) iter.Seq2[*pocketsmith.DetailedTransaction, error] {
+	return func(yield func(*pocketsmith.DetailedTransaction, error) bool) {
+		for page := 1; ; page++ {
+			txs, err := ps.ListTransactions(transactionAccountID, append(opts, pocketsmith.WithPage(page))...)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			if len(txs) == 0 {
+				return
+			}
+
+			for _, tx := range txs {
+				if !yield(tx, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// withMemoField returns the transactions whose memo has field as one of its
+// words. Pocketsmith's memo search matches substrings, so a search for
+// mtid=12 also finds mtid=123.
+func withMemoField(txs []*pocketsmith.DetailedTransaction, field string) []*pocketsmith.DetailedTransaction {
+	return slices.DeleteFunc(slices.Clone(txs), func(tx *pocketsmith.DetailedTransaction) bool {
+		return !slices.Contains(strings.Fields(tx.Memo), field)
+	})
+}
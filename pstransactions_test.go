@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/dvcrn/pocketsmith-go"
+)
+
+// fakeTransactionLister serves pages in order, one per call, followed by
+// empty pages.
+type fakeTransactionLister struct {
+	pages [][]*pocketsmith.DetailedTransaction
+	calls int
+}
+
+func (f *fakeTransactionLister) ListTransactions(accountID int, opts ...pocketsmith.ListTransactionsOption) ([]*pocketsmith.DetailedTransaction, error) {
+	f.calls++
+	if f.calls > len(f.pages) {
+		return nil, nil
+	}
+
+	return f.pages[f.calls-1], nil
+}
+
+func TestPocketsmithTransactionsPages(t *testing.T) {
+	ps := &fakeTransactionLister{pages: [][]*pocketsmith.DetailedTransaction{
+		{{ID: 1}, {ID: 2}},
+		{{ID: 3}},
+	}}
+
+	var ids []int64
+	for tx, err := range pocketsmithTransactions(ps, 10) {
+		if err != nil {
+			t.Fatalf("pocketsmithTransactions() error = %v", err)
+		}
+		ids = append(ids, tx.ID)
+	}
+	if len(ids) != 3 || ps.calls != 3 {
+		t.Errorf("got ids %v from %d requests, want 3 ids from 3 requests", ids, ps.calls)
+	}
+}
+
+func TestWithMemoField(t *testing.T) {
+	txs := []*pocketsmith.DetailedTransaction{
+		{ID: 1, Memo: "AMAZON mtid=123 kind=expense(moneytree)"},
+		{ID: 2, Memo: "AMAZON mtid=12 kind=expense(moneytree)"},
+		{ID: 3, Memo: "AMAZON mtid=1234"},
+	}
+
+	got := withMemoField(txs, "mtid=12")
+	if len(got) != 1 || got[0].ID != 2 {
+		t.Errorf("withMemoField(mtid=12) = %+v, want only transaction 2", got)
+	}
+	if len(txs) != 3 {
+		t.Errorf("withMemoField() modified its input, %d transactions left", len(txs))
+	}
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+	"github.com/getsentry/sentry-go"
+)
+
+// skippedCredential is a credential left out of the refresh, with the reason
+// why.
+type skippedCredential struct {
+	Credential moneytree.MTCredential
+	Reason     string
+}
+
+// selectCredentialsToRefresh decides which credentials get refreshed this run.
+// When institutions or credential IDs are configured, only those are
+// considered. Credentials needing an OTP or certificate or that Moneytree
+// refreshed recently on its own are only refreshed when explicitly listed.
+func selectCredentialsToRefresh(credentials []moneytree.MTCredential, config *Config, now time.Time) ([]moneytree.MTCredential, []skippedCredential) {
+	filtered := len(config.RefreshInstitutions) > 0 || len(config.RefreshCredentialIDs) > 0
+
+	var selected []moneytree.MTCredential
+	var skipped []skippedCredential
+	for _, credential := range credentials {
+		listed := slices.Contains(config.RefreshCredentialIDs, credential.ID) ||
+			slices.ContainsFunc(config.RefreshInstitutions, func(name string) bool {
+				return strings.EqualFold(strings.TrimSpace(name), strings.TrimSpace(credential.InstitutionName))
+			})
+
+		switch {
+		case filtered && !listed:
+			skipped = append(skipped, skippedCredential{credential, "not selected"})
+		case listed:
+			selected = append(selected, credential)
+		case credential.RefreshedRecently(now):
+			skipped = append(skipped, skippedCredential{credential, "refreshed recently"})
+		case credential.NeedsInteractiveAuth():
+			skipped = append(skipped, skippedCredential{credential, "needs OTP or certificate"})
+		default:
+			selected = append(selected, credential)
+		}
+	}
+
+	return selected, skipped
+}
+
+// refreshCredentials triggers a Moneytree refresh for the selected credentials
+// and waits for it to finish. Failures are reported but don't stop the sync,
+// it then just works with whatever Moneytree already has. Returns false if
+// the context was cancelled.
+func refreshCredentials(ctx context.Context, mt *moneytree.Moneytree, guest *moneytree.MTGuest, config *Config) bool {
+	selected, skipped := selectCredentialsToRefresh(guest.Credentials, config, time.Now())
+	for _, s := range skipped {
+		fmt.Printf("Not refreshing %s (credential %d): %s\n", s.Credential.InstitutionName, s.Credential.ID, s.Reason)
+	}
+
+	if len(selected) == 0 {
+		fmt.Println("No credentials to refresh")
+		return true
+	}
+
+	refreshStartedAt := time.Now()
+	var refreshedIDs []int
+	if len(skipped) == 0 {
+		if _, err := mt.RefreshAllCredentialsContext(ctx); err != nil {
+			sentry.CaptureException(err)
+			fmt.Println("Error refreshing credentials, syncing what Moneytree already has: ", err)
+			return ctx.Err() == nil
+		}
+
+		for _, credential := range selected {
+			refreshedIDs = append(refreshedIDs, credential.ID)
+		}
+	} else {
+		for _, credential := range selected {
+			if _, err := mt.RefreshCredentialContext(ctx, credential.ID); err != nil {
+				sentry.CaptureException(err)
+				fmt.Printf("Error refreshing %s (credential %d): %v\n", credential.InstitutionName, credential.ID, err)
+				continue
+			}
+
+			refreshedIDs = append(refreshedIDs, credential.ID)
+		}
+	}
+
+	if len(refreshedIDs) == 0 {
+		return ctx.Err() == nil
+	}
+
+	fmt.Printf("Refreshing %d credential(s) and waiting up to %s for them to update...\n", len(refreshedIDs), config.RefreshTimeout)
+	refreshResult, err := mt.WaitForRefresh(ctx, moneytree.WaitOptions{
+		Since:         refreshStartedAt,
+		Timeout:       config.RefreshTimeout,
+		CredentialIDs: refreshedIDs,
+	})
+	if err != nil {
+		if ctx.Err() != nil {
+			return false
+		}
+
+		sentry.CaptureException(err)
+		fmt.Println("Error waiting for the refresh, syncing what Moneytree already has: ", err)
+		return true
+	}
+
+	printRefreshResult(refreshResult)
+	return true
+}
+
+func printRefreshResult(result *moneytree.RefreshResult) {
+	fmt.Printf("Refresh finished: %d succeeded, %d failed, %d did not finish\n", len(result.Succeeded), len(result.Failed), len(result.Pending))
+
+	for _, credential := range result.Failed {
+		fmt.Printf("  refresh failed: %s (status %q)\n", credential.InstitutionName, credential.Status)
+	}
+	for _, credential := range result.Pending {
+		fmt.Printf("  refresh did not finish: %s (status %q)\n", credential.InstitutionName, credential.Status)
+	}
+}
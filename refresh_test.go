@@ -0,0 +1,47 @@
+package main
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/dvcrn/pocketsmith-anapay/moneytree"
+)
+
+func TestSelectCredentialsToRefresh(t *testing.T) {
+	now := time.Date(2025, 1, 10, 12, 0, 0, 0, time.UTC)
+	credentials := []moneytree.MTCredential{
+		{ID: 1, InstitutionName: "Rakuten Bank"},
+		{ID: 2, InstitutionName: "SMBC", AuthType: 1},
+		{ID: 3, InstitutionName: "MUFG", BackgroundRefreshFrequency: 24, LastSuccess: "2025-01-10T06:00:00Z"},
+		{ID: 4, InstitutionName: "Mizuho", UsesCertificate: true},
+	}
+
+	tests := []struct {
+		name   string
+		config Config
+		want   []int
+	}{
+		{"automatic", Config{}, []int{1}},
+		{"listed by institution", Config{RefreshInstitutions: []string{"smbc", "MUFG"}}, []int{2, 3}},
+		{"listed by ID", Config{RefreshCredentialIDs: []int{3, 4}}, []int{3, 4}},
+		{"unlisted are left out", Config{RefreshCredentialIDs: []int{1}}, []int{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, skipped := selectCredentialsToRefresh(credentials, &tt.config, now)
+
+			var got []int
+			for _, credential := range selected {
+				got = append(got, credential.ID)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("selected = %v, want %v", got, tt.want)
+			}
+			if len(selected)+len(skipped) != len(credentials) {
+				t.Errorf("%d selected + %d skipped, want %d credentials in total", len(selected), len(skipped), len(credentials))
+			}
+		})
+	}
+}